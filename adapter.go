@@ -0,0 +1,363 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// CacheAdapter is what the workload engine drives, every cache is measured
+// through it. The optional capabilities below are discovered with type
+// assertions, so a cache only implements what it really supports
+type CacheAdapter interface {
+	TestCacheIfc
+	Name() string
+}
+
+// RequestScope is the view of a cache during one request, values returned by
+// Get are only valid until Done is called
+type RequestScope interface {
+	Get(key string) (*TestStruct, bool)
+	Done()
+}
+
+// Scoper is implemented by caches whose values borrow cache memory and must
+// be released at the end of a request, eg: heyicache's lease
+type Scoper interface {
+	Begin() RequestScope
+}
+
+// PartialVerifier is implemented by caches that only round trip part of a
+// TestStruct, verification then only checks the protobuf field
+type PartialVerifier interface {
+	OnlyCheckPB() bool
+}
+
+// Peeker is implemented by caches (or request scopes) that can read without
+// updating the access time of the entry
+type Peeker interface {
+	Peek(key string) (*TestStruct, bool)
+}
+
+// Deleter is implemented by caches that can remove a key
+type Deleter interface {
+	Del(key string) bool
+}
+
+// TTLSetter is implemented by caches that support a per key expiration
+type TTLSetter interface {
+	SetWithTTL(key string, value *TestStruct, ttl time.Duration) error
+}
+
+// EvictionCounter is implemented by bounded caches that count the entries
+// they dropped to make room
+type EvictionCounter interface {
+	Evictions() int64
+}
+
+// EvacuationCounter is implemented by the ring buffer caches that count the
+// entries they took out of the way of a write: an evacuated entry was either
+// dropped or moved to the head of the ring, the count doesn't tell which
+type EvacuationCounter interface {
+	Evacuations() int64
+}
+
+// ExpirationCounter is implemented by caches that count the entries they
+// found expired
+type ExpirationCounter interface {
+	Expirations() int64
+}
+
+// CapacityReporter is implemented by bounded caches, it's the capacity in
+// bytes they were really created with
+type CapacityReporter interface {
+	Capacity() int64
+}
+
+// EntryCounter is implemented by caches that know how many entries they hold
+type EntryCounter interface {
+	EntryCount() int64
+}
+
+// EntryAccounter is implemented by caches that know how they store an entry:
+// payload is the value as the cache keeps it, header the fixed per entry
+// bookkeeping (entry header and index), the key comes on top of both
+type EntryAccounter interface {
+	EntryBytes(key string, value *TestStruct) (payload int, header int)
+}
+
+// EntryLimiter is implemented by caches that refuse entries above a size,
+// it's the largest key plus value they accept in bytes
+type EntryLimiter interface {
+	MaxEntryBytes() int
+}
+
+// ConfigReporter is implemented by caches that can describe how they were
+// configured, it's recorded next to their results
+type ConfigReporter interface {
+	Config() string
+}
+
+// ptrSize is the size of a pointer
+const ptrSize = int(unsafe.Sizeof(uintptr(0)))
+
+type Capability uint32
+
+const (
+	CapScope Capability = 1 << iota
+	CapPartialVerify
+	CapDelete
+	CapTTL
+	CapPeek
+)
+
+var capabilityNames = []string{"scope", "partial-verify", "delete", "ttl", "peek"}
+
+func (c Capability) Has(other Capability) bool {
+	return c&other == other
+}
+
+func (c Capability) String() string {
+	var names []string
+	for i, name := range capabilityNames {
+		if c.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// Capabilities reports which optional interfaces ifc implements
+func Capabilities(ifc TestCacheIfc) Capability {
+	var c Capability
+	if _, ok := ifc.(Scoper); ok {
+		c |= CapScope
+	}
+	if v, ok := ifc.(PartialVerifier); ok && v.OnlyCheckPB() {
+		c |= CapPartialVerify
+	}
+	if _, ok := ifc.(Deleter); ok {
+		c |= CapDelete
+	}
+	if _, ok := ifc.(TTLSetter); ok {
+		c |= CapTTL
+	}
+	if _, ok := ifc.(Peeker); ok {
+		c |= CapPeek
+	}
+	return c
+}
+
+// plainScope is the scope of caches that return values owned by the caller
+type plainScope struct {
+	ifc TestCacheIfc
+}
+
+func (s plainScope) Get(key string) (*TestStruct, bool) {
+	return s.ifc.Get(key)
+}
+
+func (s plainScope) Peek(key string) (*TestStruct, bool) {
+	if p, ok := s.ifc.(Peeker); ok {
+		return p.Peek(key)
+	}
+	return s.ifc.Get(key)
+}
+
+func (s plainScope) Done() {}
+
+// peek reads key through scope without updating the access time when possible
+func peek(scope RequestScope, key string) (*TestStruct, bool) {
+	if p, ok := scope.(Peeker); ok {
+		return p.Peek(key)
+	}
+	return scope.Get(key)
+}
+
+// closeCache releases the background resources of ifc if it has any, eg:
+// bigcache's cleanup goroutine keeps the whole cache reachable forever
+func closeCache(ifc TestCacheIfc) {
+	if c, ok := ifc.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// beginScope opens a request scope on ifc, caches without Scoper get a no-op one
+func beginScope(ifc TestCacheIfc) RequestScope {
+	if s, ok := ifc.(Scoper); ok {
+		return s.Begin()
+	}
+	return plainScope{ifc: ifc}
+}
+
+// ttlSeconds converts ttl to the whole seconds used by freecache and
+// heyicache, rounding up so a short ttl does not turn into "never expire"
+func ttlSeconds(ttl time.Duration) int {
+	if ttl <= 0 {
+		return 0
+	}
+	return int((ttl + time.Second - 1) / time.Second)
+}
+
+// AdapterFactory builds a fresh cache for one run
+type AdapterFactory struct {
+	Name string
+	New  func() (CacheAdapter, error)
+	// NewOn builds the cache reading the time from c instead of the system
+	// clock, nil when the cache can't take another clock
+	NewOn func(c Clock) (CacheAdapter, error)
+}
+
+// Adapters lists every cache under test, configured like the Benchmark* functions
+var Adapters = []AdapterFactory{
+	{Name: "Map", New: func() (CacheAdapter, error) { return NewTestMap(maxNum), nil }},
+	{Name: "GoCache", New: func() (CacheAdapter, error) { return NewTestGoCache(5*time.Minute, 10*time.Minute), nil }},
+	{
+		Name:  "FreeCache",
+		New:   func() (CacheAdapter, error) { return NewTestFreeCache(100 * 1024 * 1024), nil },
+		NewOn: func(c Clock) (CacheAdapter, error) { return NewTestFreeCacheOn(100*1024*1024, c), nil },
+	},
+	{Name: "BigCache", New: func() (CacheAdapter, error) { return NewTestBigCache(10 * time.Minute) }},
+	{
+		Name:  "HeyiCache",
+		New:   func() (CacheAdapter, error) { return NewTestHeyiCache(100), nil },
+		NewOn: func(c Clock) (CacheAdapter, error) { return NewTestHeyiCacheOn(100, c), nil },
+	},
+}
+
+// NullAdapter builds the cache that stores nothing, it's not in Adapters:
+// it's the calibration baseline, not a cache under test
+var NullAdapter = AdapterFactory{Name: "Null", New: func() (CacheAdapter, error) { return NewTestNullCache(), nil }}
+
+// SizedAdapterFactory builds a fresh cache bounded to about capacity bytes
+type SizedAdapterFactory struct {
+	Name string
+	New  func(capacity int64) (CacheAdapter, error)
+	// NewOn builds it on clock c, see AdapterFactory.NewOn
+	NewOn func(capacity int64, c Clock) (CacheAdapter, error)
+}
+
+// SizedAdapters lists the caches whose capacity can be configured, the map and
+// go-cache evict by their own accounting (see byteBudget), heyicache gets its
+// MinCapacity when asked for less
+var SizedAdapters = []SizedAdapterFactory{
+	{Name: "Map", New: func(capacity int64) (CacheAdapter, error) { return NewTestMapBounded(0, capacity), nil }},
+	{Name: "GoCache", New: func(capacity int64) (CacheAdapter, error) {
+		return NewTestGoCacheBounded(5*time.Minute, 10*time.Minute, capacity), nil
+	}},
+	{
+		Name: "FreeCache",
+		New:  func(capacity int64) (CacheAdapter, error) { return NewTestFreeCache(int(capacity)), nil },
+		NewOn: func(capacity int64, c Clock) (CacheAdapter, error) {
+			return NewTestFreeCacheOn(int(capacity), c), nil
+		},
+	},
+	{Name: "BigCache", New: func(capacity int64) (CacheAdapter, error) {
+		return NewTestBigCacheSized(10*time.Minute, toMB(capacity))
+	}},
+	{
+		Name: "HeyiCache",
+		New: func(capacity int64) (CacheAdapter, error) {
+			return NewTestHeyiCache(max(heyiCacheMinMB, toMB(capacity))), nil
+		},
+		NewOn: func(capacity int64, c Clock) (CacheAdapter, error) {
+			return NewTestHeyiCacheOn(max(heyiCacheMinMB, toMB(capacity)), c), nil
+		},
+	},
+}
+
+// MinCapacity is the smallest capacity in bytes the sized caches that have one
+// can be built with
+var MinCapacity = map[string]int64{"HeyiCache": heyiCacheMinMB << 20}
+
+// WithCapacity fixes the capacity of the caches f builds
+func (f SizedAdapterFactory) WithCapacity(capacity int64) AdapterFactory {
+	sized := AdapterFactory{Name: f.Name, New: func() (CacheAdapter, error) { return f.New(capacity) }}
+	if f.NewOn != nil {
+		sized.NewOn = func(c Clock) (CacheAdapter, error) { return f.NewOn(capacity, c) }
+	}
+	return sized
+}
+
+// CodecAdapters names the caches that store encoded values, see CodecSetter
+var CodecAdapters = []string{"FreeCache", "BigCache"}
+
+// WithCodec makes the caches f builds encode their values with c, the name
+// gets the codec as suffix like the caches' Name
+func (f AdapterFactory) WithCodec(c Codec) AdapterFactory {
+	encoding := func(ifc CacheAdapter, err error) (CacheAdapter, error) {
+		if err != nil {
+			return nil, err
+		}
+		setter, ok := ifc.(CodecSetter)
+		if !ok {
+			closeCache(ifc)
+			return nil, fmt.Errorf("%s doesn't encode its values", f.Name)
+		}
+		setter.SetCodec(c)
+		return ifc, nil
+	}
+	encoded := AdapterFactory{Name: f.Name + codecSuffix(c), New: func() (CacheAdapter, error) { return encoding(f.New()) }}
+	if f.NewOn != nil {
+		encoded.NewOn = func(clock Clock) (CacheAdapter, error) { return encoding(f.NewOn(clock)) }
+	}
+	return encoded
+}
+
+// WithCodecs replaces every cache of factories that stores encoded values by
+// one per codec, the other caches are kept once
+func WithCodecs(factories []AdapterFactory, codecs []Codec) []AdapterFactory {
+	if len(codecs) == 0 {
+		return factories
+	}
+	var expanded []AdapterFactory
+	for _, factory := range factories {
+		if !slices.Contains(CodecAdapters, factory.Name) {
+			expanded = append(expanded, factory)
+			continue
+		}
+		for _, c := range codecs {
+			expanded = append(expanded, factory.WithCodec(c))
+		}
+	}
+	return expanded
+}
+
+// WithClock makes the caches f builds read the time from c, f must have
+// NewOn
+func (f AdapterFactory) WithClock(c Clock) AdapterFactory {
+	return AdapterFactory{Name: f.Name, New: func() (CacheAdapter, error) { return f.NewOn(c) }}
+}
+
+// toMB rounds bytes up to whole megabytes
+func toMB(bytes int64) int {
+	return int((bytes + 1<<20 - 1) >> 20)
+}
+
+var (
+	_ CacheAdapter = (*TestMap)(nil)
+	_ CacheAdapter = (*TestGoCache)(nil)
+	_ CacheAdapter = (*TestFreeCache)(nil)
+	_ CacheAdapter = (*TestBigCache)(nil)
+	_ CacheAdapter = (*TestHeyiCache)(nil)
+	_ CacheAdapter = (*TestNullCache)(nil)
+	_ Scoper       = (*TestHeyiCache)(nil)
+	_ CodecSetter  = (*TestFreeCache)(nil)
+	_ CodecSetter  = (*TestBigCache)(nil)
+
+	_ EvictionCounter = (*TestMap)(nil)
+	_ EvictionCounter = (*TestGoCache)(nil)
+	_ EvictionCounter = (*TestBigCache)(nil)
+	_ EvictionCounter = (*TestHeyiCache)(nil)
+
+	_ EvacuationCounter = (*TestFreeCache)(nil)
+
+	_ ExpirationCounter = (*TestFreeCache)(nil)
+	_ ExpirationCounter = (*TestHeyiCache)(nil)
+)
@@ -1,18 +1,15 @@
-package main
+package benchmark
 
 import (
-	"context"
 	"fmt"
-	"sync"
+	"runtime"
+	"sort"
 	"testing"
-
-	"github.com/yuadsl3010/heyicache"
+	"time"
 )
 
 var (
-	maxNum       = 1000000
-	checkNum     = 100 // 1 write, 99 read times, the 100th time will check the data
-	goroutineNum = 100 // 100 goroutines
+	maxNum = 1000000
 )
 
 type TestCacheIfc interface {
@@ -27,6 +24,95 @@ type BenchResult struct {
 	WriteFail    uint64
 	CheckSuccess uint64
 	CheckFail    uint64
+	DelSuccess   uint64
+	DelMiss      uint64
+	LeaseChecked uint64      // values compared right before the end of their request scope
+	LeaseCorrupt uint64      // of them, the values that changed while the scope was open
+	StaleChecked uint64      // values compared a while after the end of their request scope
+	StaleCorrupt uint64      // of them, the values that changed after the scope ended
+	TTLChecked   uint64      // hits checked against the expiry of their entry
+	TTLStale     uint64      // of them, the hits served after the entry expired
+	Expired      uint64      // entries the cache found expired during the run, 0 when it doesn't count them
+	Latency      *LatencySet // nil when the workload doesn't record latency
+
+	Elapsed    time.Duration // wall time of the run
+	CPU        time.Duration // CPU time the process spent during the run, 0 when not measured
+	TargetRate float64       // target operations per second, 0 in closed loop mode
+	GC         *GCStats
+	App        *AppStats     // nil when the workload runs without the application goroutine
+	Harness    float64       // estimated ns per operation the benchmark spent building keys and values
+	NullNs     float64       // CPU ns per operation of the same workload against the null cache, 0 when not calibrated
+	Resident   int64         // heap bytes the cache held at the end of the run, 0 when not measured
+	Budget     int64         // bytes the cache was given, 0 when unbounded
+	SimElapsed time.Duration // simulated time the run covered, 0 on the system clock
+
+	// Mismatches counts the failed verifications per field path, see
+	// VerifyTestStruct
+	Mismatches map[string]uint64
+}
+
+// maxMismatchPaths bounds the paths counted in Mismatches, the others are
+// counted under "..."
+const maxMismatchPaths = 64
+
+// addMismatches counts the paths of mismatches
+func (result *BenchResult) addMismatches(mismatches []Mismatch) {
+	if result.Mismatches == nil {
+		result.Mismatches = map[string]uint64{}
+	}
+	for _, m := range mismatches {
+		path := m.Path
+		if _, ok := result.Mismatches[path]; !ok && len(result.Mismatches) >= maxMismatchPaths {
+			path = "..."
+		}
+		result.Mismatches[path]++
+	}
+}
+
+// Ops is the number of operations the run issued
+func (result *BenchResult) Ops() uint64 {
+	return result.ReadSuccess + result.ReadMiss + result.WriteSuccess + result.WriteFail + result.DelSuccess + result.DelMiss
+}
+
+// HarnessCPU is the percentage of the CPU time of the run the benchmark spent
+// building keys and values rather than in the cache
+func (result *BenchResult) HarnessCPU() float64 {
+	cpu := float64(result.CPU)
+	if cpu <= 0 {
+		return 0
+	}
+	return min(result.Harness*float64(result.Ops())/cpu*100, 100)
+}
+
+// CPUNsPerOp is the CPU time per operation, 0 when the CPU time wasn't
+// measured
+func (result *BenchResult) CPUNsPerOp() float64 {
+	ops := result.Ops()
+	if ops == 0 {
+		return 0
+	}
+	return float64(result.CPU) / float64(ops)
+}
+
+// HitRate is the percentage of reads that found their key
+func (result *BenchResult) HitRate() float64 {
+	return rate(result.ReadSuccess, result.ReadSuccess+result.ReadMiss)
+}
+
+// Throughput is the achieved operations per second
+func (result *BenchResult) Throughput() float64 {
+	if result.Elapsed <= 0 {
+		return 0
+	}
+	return float64(result.Ops()) / result.Elapsed.Seconds()
+}
+
+// ResidentPercent is the resident heap of the cache relative to its budget
+func (result *BenchResult) ResidentPercent() float64 {
+	if result.Budget <= 0 {
+		return 0
+	}
+	return 100 * float64(result.Resident) / float64(result.Budget)
 }
 
 func (result *BenchResult) String() string {
@@ -34,162 +120,266 @@ func (result *BenchResult) String() string {
 	writeTotal := result.WriteSuccess + result.WriteFail
 	checkTotal := result.CheckSuccess + result.CheckFail
 
-	readFailRate := 0.0
-	if readTotal > 0 {
-		readFailRate = float64(result.ReadMiss) / float64(readTotal) * 100
-	}
-	writeFailRate := 0.0
-	if writeTotal > 0 {
-		writeFailRate = float64(result.WriteFail) / float64(writeTotal) * 100
-	}
-	checkFailRate := 0.0
-	if checkTotal > 0 {
-		checkFailRate = float64(result.CheckFail) / float64(checkTotal) * 100
-	}
+	readFailRate := rate(result.ReadMiss, readTotal)
+	writeFailRate := rate(result.WriteFail, writeTotal)
+	checkFailRate := rate(result.CheckFail, checkTotal)
 
-	return fmt.Sprintf(
-		"\nRead: success=%d miss=%d missRate=%.2f%%\nWrite: success=%d fail=%d failRate=%.2f%%\nCheck: success=%d fail=%d failRate=%.2f%%",
+	s := fmt.Sprintf(
+		"\nRead: success=%d miss=%d missRate=%.2f%%\nWrite: success=%d fail=%d failRate=%.2f%%\nCheck: success=%d fail=%d failRate=%.2f%%\nDel: success=%d miss=%d",
 		result.ReadSuccess, result.ReadMiss, readFailRate,
 		result.WriteSuccess, result.WriteFail, writeFailRate,
 		result.CheckSuccess, result.CheckFail, checkFailRate,
+		result.DelSuccess, result.DelMiss,
 	)
+	s += fmt.Sprintf("\nThroughput: %.0f ops/s", result.Throughput())
+	if result.TargetRate > 0 {
+		s += fmt.Sprintf(" target=%.0f ops/s", result.TargetRate)
+	}
+	if result.LeaseChecked > 0 {
+		s += fmt.Sprintf("\nLease: checked=%d corrupt=%d", result.LeaseChecked, result.LeaseCorrupt)
+	}
+	if result.StaleChecked > 0 {
+		s += fmt.Sprintf("\nStale: checked=%d corrupt=%d", result.StaleChecked, result.StaleCorrupt)
+	}
+	if result.TTLChecked > 0 {
+		s += fmt.Sprintf("\nTTL: checked=%d stale=%d", result.TTLChecked, result.TTLStale)
+		if result.Expired > 0 {
+			s += fmt.Sprintf(" expired=%d", result.Expired)
+		}
+		if result.SimElapsed > 0 {
+			s += fmt.Sprintf(" simulated=%s", result.SimElapsed)
+		}
+	}
+	if result.Resident > 0 {
+		s += fmt.Sprintf("\nMemory: resident=%.1fMB", float64(result.Resident)/(1<<20))
+		if result.Budget > 0 {
+			s += fmt.Sprintf(" budget=%.1fMB (%.0f%%)", float64(result.Budget)/(1<<20), result.ResidentPercent())
+		}
+	}
+	if len(result.Mismatches) > 0 {
+		s += "\nMismatches:"
+		paths := make([]string, 0, len(result.Mismatches))
+		for path := range result.Mismatches {
+			paths = append(paths, path)
+		}
+		sort.Slice(paths, func(i, j int) bool {
+			if result.Mismatches[paths[i]] != result.Mismatches[paths[j]] {
+				return result.Mismatches[paths[i]] > result.Mismatches[paths[j]]
+			}
+			return paths[i] < paths[j]
+		})
+		for _, path := range paths {
+			s += fmt.Sprintf("\n  %s: %d", path, result.Mismatches[path])
+		}
+	}
+	if result.Latency != nil {
+		s += result.Latency.String()
+	}
+	if result.GC != nil {
+		s += result.GC.String()
+	}
+	if result.App != nil {
+		s += result.App.String()
+	}
+	return s
+}
+
+// Merge adds the counters of other into result
+func (result *BenchResult) Merge(other *BenchResult) {
+	result.ReadSuccess += other.ReadSuccess
+	result.ReadMiss += other.ReadMiss
+	result.WriteSuccess += other.WriteSuccess
+	result.WriteFail += other.WriteFail
+	result.CheckSuccess += other.CheckSuccess
+	result.CheckFail += other.CheckFail
+	result.DelSuccess += other.DelSuccess
+	result.DelMiss += other.DelMiss
+	result.LeaseChecked += other.LeaseChecked
+	result.LeaseCorrupt += other.LeaseCorrupt
+	result.StaleChecked += other.StaleChecked
+	result.StaleCorrupt += other.StaleCorrupt
+	result.TTLChecked += other.TTLChecked
+	result.TTLStale += other.TTLStale
+	result.Expired += other.Expired
+	if len(other.Mismatches) > 0 && result.Mismatches == nil {
+		result.Mismatches = map[string]uint64{}
+	}
+	for path, n := range other.Mismatches {
+		if _, ok := result.Mismatches[path]; !ok && len(result.Mismatches) >= maxMismatchPaths {
+			path = "..."
+		}
+		result.Mismatches[path] += n
+	}
+	if other.Latency != nil {
+		if result.Latency == nil {
+			result.Latency = &LatencySet{}
+		}
+		result.Latency.Merge(other.Latency)
+	}
 }
 
-func getId(idx, gIdx int) int {
-	// return (idx + gIdx*goroutineNum) % maxNum
-	return idx % maxNum
+func rate(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
 }
 
-func BenchIfc(b *testing.B, ifc TestCacheIfc) {
-	result := &BenchResult{}
-	wg := &sync.WaitGroup{}
-	wg.Add(goroutineNum)
-	for g := 0; g < goroutineNum; g++ {
-		go func(gIdx int) {
-			defer wg.Done()
-			for i := 0; i < b.N; i++ {
-				id := getId(i, gIdx)
-				for j := 0; j < checkNum; j++ {
-					if j%checkNum == 0 {
-						// 1th set
-						k, v := NewTestStruct(id)
-						if err := ifc.Set(k, v); err != nil {
-							result.WriteFail++
-						} else {
-							result.WriteSuccess++
-						}
-					} else {
-						// 2~100th get
-						v, ok := ifc.Get(GetKey(id))
-						if ok {
-							result.ReadSuccess++
-							if j%checkNum == checkNum-1 {
-								// 100th check
-								if CheckTestStruct(id, v, false) {
-									result.CheckSuccess++
-								} else {
-									result.CheckFail++
-								}
-							}
-						} else {
-							result.ReadMiss++
-						}
-					}
-				}
-			}
-		}(g)
+// Metric is one named number of a result, the name is the unit of a
+// benchmark line, eg: "ops/s" or "get-hit-p99-ns"
+type Metric struct {
+	Name  string  `json:"name"`
+	Value float64 `json:"value"`
+}
+
+// Metrics flattens the result into its metrics, the per op metrics are
+// divided by the cache operations, not the requests of a benchmark
+func (result *BenchResult) Metrics() []Metric {
+	readTotal := result.ReadSuccess + result.ReadMiss
+	writeTotal := result.WriteSuccess + result.WriteFail
+	checkTotal := result.CheckSuccess + result.CheckFail
+	n := max(result.Ops(), 1)
+
+	metrics := []Metric{
+		{"hit%", rate(result.ReadSuccess, readTotal)},
+		{"miss%", rate(result.ReadMiss, readTotal)},
+		{"write-fail%", rate(result.WriteFail, writeTotal)},
+		{"check-fail%", rate(result.CheckFail, checkTotal)},
+		{"ops/s", result.Throughput()},
+	}
+	if result.TargetRate > 0 {
+		metrics = append(metrics, Metric{"target-ops/s", result.TargetRate})
+	}
+	if result.LeaseChecked > 0 {
+		metrics = append(metrics, Metric{"lease-corrupt%", rate(result.LeaseCorrupt, result.LeaseChecked)})
+	}
+	if result.StaleChecked > 0 {
+		metrics = append(metrics, Metric{"stale-corrupt%", rate(result.StaleCorrupt, result.StaleChecked)})
+	}
+	if result.TTLChecked > 0 {
+		metrics = append(metrics, Metric{"ttl-stale%", rate(result.TTLStale, result.TTLChecked)})
+	}
+	if result.Expired > 0 {
+		metrics = append(metrics, Metric{"expired%", rate(result.Expired, result.Ops())})
+	}
+	if result.SimElapsed > 0 {
+		metrics = append(metrics, Metric{"sim-s", result.SimElapsed.Seconds()})
+	}
+	if result.Harness > 0 {
+		metrics = append(metrics,
+			Metric{"harness-ns/op", result.Harness},
+			Metric{"harness-cpu%", result.HarnessCPU()},
+		)
+	}
+	if result.NullNs > 0 && result.CPU > 0 {
+		// the harness overhead measured with the null cache taken out
+		cpu := result.CPUNsPerOp()
+		net := max(cpu-result.NullNs, 0)
+		metrics = append(metrics,
+			Metric{"cpu-ns/op", cpu},
+			Metric{"null-ns/op", result.NullNs},
+			Metric{"net-ns/op", net},
+		)
+		if net > 0 && result.Elapsed > 0 {
+			// the CPUs the run kept busy, spent on the cache alone
+			busy := float64(result.CPU) / float64(result.Elapsed)
+			metrics = append(metrics, Metric{"net-ops/s", 1e9 * busy / net})
+		}
 	}
-	wg.Wait()
+	if result.Resident > 0 {
+		metrics = append(metrics, Metric{"resident-MB", float64(result.Resident) / (1 << 20)})
+		if result.Budget > 0 {
+			metrics = append(metrics,
+				Metric{"budget-MB", float64(result.Budget) / (1 << 20)},
+				Metric{"resident/budget%", result.ResidentPercent()},
+			)
+		}
+	}
+	if gc := result.GC; gc != nil {
+		metrics = append(metrics,
+			Metric{"gc-cycles/op", float64(gc.Cycles) / float64(n)},
+			Metric{"gc-stw-ns/op", float64(gc.PauseTotal) / float64(n)},
+			Metric{"gc-max-pause-ns", float64(gc.PauseMax)},
+			Metric{"gc-cpu%", gc.GCCPUFraction * 100},
+			Metric{"heap-live-MB", float64(gc.HeapLive) / (1 << 20)},
+			Metric{"heap-scan-MB", float64(gc.HeapScan) / (1 << 20)},
+			Metric{"heap-objects", float64(gc.HeapObjects)},
+		)
+	}
+	if app := result.App; app != nil {
+		metrics = append(metrics,
+			Metric{"app-iters/s", app.Throughput()},
+			Metric{"app-p99-ns", float64(app.Latency.Quantile(0.99))},
+			Metric{"app-max-ns", float64(app.Latency.Max())},
+		)
+	}
+	if result.Latency == nil {
+		return metrics
+	}
+	for i := range result.Latency {
+		h := &result.Latency[i]
+		if h.Count() == 0 {
+			continue
+		}
+		op := LatencyOp(i).String()
+		for _, q := range reportQuantiles {
+			metrics = append(metrics, Metric{op + "-" + q.Name + "-ns", float64(h.Quantile(q.Q))})
+		}
+		metrics = append(metrics, Metric{op + "-max-ns", float64(h.Max())})
+	}
+	return metrics
 }
 
-func BenchIfcForFreeCacheAndBigCache(b *testing.B, ifc TestCacheIfc) {
-	result := &BenchResult{}
-	wg := &sync.WaitGroup{}
-	wg.Add(goroutineNum)
-	for g := 0; g < goroutineNum; g++ {
-		go func(gIdx int) {
-			defer wg.Done()
-			for i := 0; i < b.N; i++ {
-				id := getId(i, gIdx)
-				for j := 0; j < checkNum; j++ {
-					if j%checkNum == 0 {
-						// 1th set
-						k, v := NewTestStruct(id)
-						if err := ifc.Set(k, v); err != nil {
-							result.WriteFail++
-						} else {
-							result.WriteSuccess++
-						}
-					} else {
-						// 2~100th get
-						v, ok := ifc.Get(GetKey(id))
-						if ok {
-							result.ReadSuccess++
-							if j%checkNum == checkNum-1 {
-								// 100th check
-								if CheckTestStruct(id, v, true) {
-									result.CheckSuccess++
-								} else {
-									result.CheckFail++
-								}
-							}
-						} else {
-							result.ReadMiss++
-						}
-					}
-				}
-			}
-		}(g)
+// Report publishes the merged rates as benchmark metrics, so they show up in
+// go test -bench output and can be compared by benchstat
+func (result *BenchResult) Report(b *testing.B) {
+	for _, m := range result.Metrics() {
+		b.ReportMetric(m.Value, m.Name)
 	}
-	wg.Wait()
 }
 
-// only add lease logic for BenchIfc
-func BenchHeyiCache(b *testing.B, heyi *TestHeyiCache) {
+// mergeResults folds the per goroutine shards into one result
+func mergeResults(shards []BenchResult) *BenchResult {
 	result := &BenchResult{}
-	wg := &sync.WaitGroup{}
-	wg.Add(goroutineNum)
-	for g := 0; g < goroutineNum; g++ {
-		go func(gIdx int) {
-			defer wg.Done()
-			for i := 0; i < b.N; i++ {
-				id := getId(i, gIdx)
-				ctx := heyicache.NewLeaseCtx(context.Background())
-				leaseCtx := heyicache.GetLeaseCtx(ctx)
-				leaseStoreCache := leaseCtx.GetLease(heyi.Cache)
-				for j := 0; j < checkNum; j++ {
-					if j%checkNum == 0 {
-						// 1th set
-						k, v := NewTestStruct(id)
-						if err := heyi.Set(k, v); err != nil {
-							// panic(err)
-							result.WriteFail++
-						} else {
-							result.WriteSuccess++
-						}
-					} else {
-						// 2~100th get
-						v, ok := heyi.Get(leaseStoreCache, GetKey(id))
-						if ok {
-							result.ReadSuccess++
-							if j%checkNum == checkNum-1 {
-								// 100th check
-								if CheckTestStruct(id, v, false) {
-									result.CheckSuccess++
-								} else {
-									result.CheckFail++
-								}
-							}
-						} else {
-							result.ReadMiss++
-						}
-					}
-				}
-
-				heyicache.GetLeaseCtx(ctx).Done()
-			}
-		}(g)
+	for i := range shards {
+		result.Merge(&shards[i])
+	}
+	return result
+}
+
+// BenchIfc runs the loop of the original benchmark against ifc, see
+// BaselineWorkload and BenchWorkload
+func BenchIfc(b *testing.B, ifc CacheAdapter) {
+	BenchWorkload(b, ifc, BaselineWorkload)
+}
+
+// BenchWorkload loads the records, then runs wl against ifc and reports the
+// merged result, every cache is measured by this same loop
+func BenchWorkload(b *testing.B, ifc CacheAdapter, wl Workload) {
+	if err := wl.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	if err := checkCapabilities(ifc, &wl); err != nil {
+		b.Skip(err)
+	}
+	b.Cleanup(func() { closeCache(ifc) })
+	wl.Prepare()
+	if wl.Preload {
+		LoadRecords(ifc, &wl)
+	}
+	// the garbage of the load phase must not be collected during the run
+	runtime.GC()
+	b.ResetTimer()
+	RunWorkload(ifc, &wl, b.N).Report(b)
+}
+
+// checkCapabilities fails when wl needs an operation ifc doesn't support
+func checkCapabilities(ifc CacheAdapter, wl *Workload) error {
+	if wl.Delete > 0 && !Capabilities(ifc).Has(CapDelete) {
+		return fmt.Errorf("%s: workload %s deletes but the cache can't", ifc.Name(), wl.Name)
+	}
+	if wl.TTL != nil && !Capabilities(ifc).Has(CapTTL) {
+		return fmt.Errorf("%s: workload %s expires its records but the cache can't", ifc.Name(), wl.Name)
 	}
-	wg.Wait()
-	fmt.Println(result.String())
+	return nil
 }
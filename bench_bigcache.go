@@ -1,7 +1,12 @@
-package main
+package benchmark
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/allegro/bigcache/v3"
@@ -9,21 +14,41 @@ import (
 
 // TestBigCache 使用 bigcache 包实现的 TestCacheIfc 接口
 type TestBigCache struct {
-	cache *bigcache.BigCache
+	cache     *bigcache.BigCache
+	config    bigcache.Config
+	capacity  int64
+	codec     Codec
+	evictions atomic.Int64
 }
 
 // NewTestBigCache 创建一个新的 TestBigCache 实例
 func NewTestBigCache(eviction time.Duration) (*TestBigCache, error) {
+	return NewTestBigCacheSized(eviction, 0)
+}
+
+// NewTestBigCacheSized 创建一个最多使用 maxSizeMB 的 TestBigCache 实例，0 表示不限制
+func NewTestBigCacheSized(eviction time.Duration, maxSizeMB int) (*TestBigCache, error) {
+	b := &TestBigCache{
+		capacity: int64(maxSizeMB) * 1024 * 1024,
+		codec:    DefaultCodec,
+	}
 	config := bigcache.DefaultConfig(eviction)
 	config.Verbose = false // 禁用日志输出
+	config.HardMaxCacheSize = maxSizeMB
+	// 统计因为空间不足被淘汰的个数
+	config.OnRemoveWithReason = func(_ string, _ []byte, reason bigcache.RemoveReason) {
+		if reason == bigcache.NoSpace {
+			b.evictions.Add(1)
+		}
+	}
 	cache, err := bigcache.New(context.Background(), config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TestBigCache{
-		cache: cache,
-	}, nil
+	b.cache = cache
+	b.config = config
+	return b, nil
 }
 
 // Get 实现 TestCacheIfc.Get 方法
@@ -33,8 +58,7 @@ func (b *TestBigCache) Get(key string) (*TestStruct, bool) {
 		return nil, false
 	}
 
-	// 使用 protobuf 反序列化
-	value, err := DeserializeTestStruct(data)
+	value, err := b.codec.Decode(data)
 	if err != nil {
 		return nil, false
 	}
@@ -42,13 +66,79 @@ func (b *TestBigCache) Get(key string) (*TestStruct, bool) {
 	return value, true
 }
 
+// errBigCacheLargeKey bigcache 的 entry header 只用 16 位保存 key 的长度，更长的 key 写入成功但再也读不到
+var errBigCacheLargeKey = errors.New("bigcache: key longer than 65535 bytes")
+
 // Set 实现 TestCacheIfc.Set 方法
 func (b *TestBigCache) Set(key string, value *TestStruct) error {
-	// 使用 protobuf 序列化
-	data, err := SerializeTestStruct(value)
+	if len(key) > math.MaxUint16 {
+		return errBigCacheLargeKey
+	}
+	data, err := b.codec.Encode(value)
 	if err != nil {
 		return err
 	}
 
 	return b.cache.Set(key, data)
 }
+
+func (b *TestBigCache) Name() string {
+	return "BigCache" + codecSuffix(b.codec)
+}
+
+// SetCodec 实现 CodecSetter.SetCodec 方法
+func (b *TestBigCache) SetCodec(c Codec) {
+	b.codec = c
+}
+
+// Config 实现 ConfigReporter.Config 方法
+func (b *TestBigCache) Config() string {
+	return fmt.Sprintf("shards=%d lifeWindow=%s hardMaxCacheSizeMB=%d codec=%s", b.config.Shards, b.config.LifeWindow, b.config.HardMaxCacheSize, b.codec.Name())
+}
+
+// CopiesFlat 实现 FlatCopier.CopiesFlat 方法，取决于 codec 保存了哪些字段
+func (b *TestBigCache) CopiesFlat() bool {
+	return b.codec.VerifyMode() == VerifyFlat
+}
+
+// OnlyCheckPB 实现 PartialVerifier.OnlyCheckPB 方法，protobuf codec 只保存了 TestProto 字段
+func (b *TestBigCache) OnlyCheckPB() bool {
+	return b.codec.VerifyMode() == VerifyProto
+}
+
+// Del 实现 Deleter.Del 方法
+func (b *TestBigCache) Del(key string) bool {
+	return b.cache.Delete(key) == nil
+}
+
+// Close 停止 bigcache 的清理 goroutine，否则它会让整个 cache 一直无法被回收
+func (b *TestBigCache) Close() error {
+	return b.cache.Close()
+}
+
+// Evictions 实现 EvictionCounter.Evictions 方法
+func (b *TestBigCache) Evictions() int64 {
+	return b.evictions.Load()
+}
+
+// Capacity 实现 CapacityReporter.Capacity 方法
+func (b *TestBigCache) Capacity() int64 {
+	return b.capacity
+}
+
+// EntryCount 实现 EntryCounter.EntryCount 方法
+func (b *TestBigCache) EntryCount() int64 {
+	return int64(b.cache.Len())
+}
+
+// bigcache 的 entry header: timestamp + hash + key 长度
+const bigCacheEntryHeaderSize = 8 + 8 + 2
+
+// EntryBytes 实现 EntryAccounter.EntryBytes 方法
+// BytesQueue 里的 varint 长度 + entry header，再加上 shard 里 map[uint64]uint64 的索引
+func (b *TestBigCache) EntryBytes(key string, value *TestStruct) (int, int) {
+	data, _ := b.codec.Encode(value)
+	blob := bigCacheEntryHeaderSize + len(key) + len(data)
+	var varint [binary.MaxVarintLen32]byte
+	return len(data), binary.PutUvarint(varint[:], uint64(blob)) + bigCacheEntryHeaderSize + 16
+}
@@ -1,18 +1,30 @@
-package main
+package benchmark
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/coocood/freecache"
 )
 
 // TestFreeCache 使用 freecache 包实现的 TestCacheIfc 接口
 type TestFreeCache struct {
-	cache *freecache.Cache
+	cache    *freecache.Cache
+	capacity int64
+	codec    Codec
 }
 
 // NewTestFreeCache 创建一个新的 TestFreeCache 实例
 func NewTestFreeCache(cacheSize int) *TestFreeCache {
+	return NewTestFreeCacheOn(cacheSize, nil)
+}
+
+// NewTestFreeCacheOn 创建一个从 clock 读取时间的 TestFreeCache 实例，clock 为 nil 时使用系统时间
+func NewTestFreeCacheOn(cacheSize int, clock Clock) *TestFreeCache {
 	return &TestFreeCache{
-		cache: freecache.NewCache(cacheSize),
+		cache:    freecache.NewCacheCustomTimer(cacheSize, clock),
+		capacity: int64(cacheSize),
+		codec:    DefaultCodec,
 	}
 }
 
@@ -23,8 +35,22 @@ func (f *TestFreeCache) Get(key string) (*TestStruct, bool) {
 		return nil, false
 	}
 
-	// 使用 protobuf 反序列化
-	value, err := DeserializeTestStruct(data)
+	value, err := f.codec.Decode(data)
+	if err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Peek 实现 Peeker.Peek 方法，不更新访问时间
+func (f *TestFreeCache) Peek(key string) (*TestStruct, bool) {
+	data, err := f.cache.Peek(StringToByte(key))
+	if err != nil {
+		return nil, false
+	}
+
+	value, err := f.codec.Decode(data)
 	if err != nil {
 		return nil, false
 	}
@@ -34,8 +60,7 @@ func (f *TestFreeCache) Get(key string) (*TestStruct, bool) {
 
 // Set 实现 TestCacheIfc.Set 方法
 func (f *TestFreeCache) Set(key string, value *TestStruct) error {
-	// 使用 protobuf 序列化
-	data, err := SerializeTestStruct(value)
+	data, err := f.codec.Encode(value)
 	if err != nil {
 		return err
 	}
@@ -43,3 +68,77 @@ func (f *TestFreeCache) Set(key string, value *TestStruct) error {
 	// freecache 需要指定过期时间（秒），这里设置为0表示永不过期
 	return f.cache.Set(StringToByte(key), data, 0)
 }
+
+func (f *TestFreeCache) Name() string {
+	return "FreeCache" + codecSuffix(f.codec)
+}
+
+// SetCodec 实现 CodecSetter.SetCodec 方法
+func (f *TestFreeCache) SetCodec(c Codec) {
+	f.codec = c
+}
+
+// MaxEntryBytes 实现 EntryLimiter.MaxEntryBytes 方法
+// 256 个 segment，每个 entry 最多占 segment 的 1/4
+func (f *TestFreeCache) MaxEntryBytes() int {
+	return int(f.capacity/256/4) - freecache.ENTRY_HDR_SIZE
+}
+
+// Config 实现 ConfigReporter.Config 方法
+func (f *TestFreeCache) Config() string {
+	return fmt.Sprintf("size=%d codec=%s", f.capacity, f.codec.Name())
+}
+
+// CopiesFlat 实现 FlatCopier.CopiesFlat 方法，取决于 codec 保存了哪些字段
+func (f *TestFreeCache) CopiesFlat() bool {
+	return f.codec.VerifyMode() == VerifyFlat
+}
+
+// OnlyCheckPB 实现 PartialVerifier.OnlyCheckPB 方法，protobuf codec 只保存了 TestProto 字段
+func (f *TestFreeCache) OnlyCheckPB() bool {
+	return f.codec.VerifyMode() == VerifyProto
+}
+
+// Del 实现 Deleter.Del 方法
+func (f *TestFreeCache) Del(key string) bool {
+	return f.cache.Del(StringToByte(key))
+}
+
+// SetWithTTL 实现 TTLSetter.SetWithTTL 方法，freecache 的过期时间精度为秒
+func (f *TestFreeCache) SetWithTTL(key string, value *TestStruct, ttl time.Duration) error {
+	data, err := f.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+
+	return f.cache.Set(StringToByte(key), data, ttlSeconds(ttl))
+}
+
+// Expirations 实现 ExpirationCounter.Expirations 方法
+// freecache 在 Get 和腾出空间时发现过期都会计数
+func (f *TestFreeCache) Expirations() int64 {
+	return f.cache.ExpiredCount()
+}
+
+// Evacuations 实现 EvacuationCounter.Evacuations 方法
+// freecache 腾出空间时，最近访问过的 entry 被挪到 ring buffer 头部，其余的被淘汰，两种都计入 EvacuateCount
+func (f *TestFreeCache) Evacuations() int64 {
+	return f.cache.EvacuateCount()
+}
+
+// Capacity 实现 CapacityReporter.Capacity 方法
+func (f *TestFreeCache) Capacity() int64 {
+	return f.capacity
+}
+
+// EntryCount 实现 EntryCounter.EntryCount 方法
+func (f *TestFreeCache) EntryCount() int64 {
+	return f.cache.EntryCount()
+}
+
+// EntryBytes 实现 EntryAccounter.EntryBytes 方法
+// ring buffer 里的 entry header 加上 slot 里的 entryPtr
+func (f *TestFreeCache) EntryBytes(key string, value *TestStruct) (int, int) {
+	data, _ := f.codec.Encode(value)
+	return len(data), freecache.ENTRY_HDR_SIZE + freecache.HASH_ENTRY_SIZE
+}
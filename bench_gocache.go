@@ -1,23 +1,45 @@
-package main
+package benchmark
 
 import (
+	"fmt"
+	"sync"
 	"time"
+	"unsafe"
 
 	"github.com/patrickmn/go-cache"
 )
 
 // TestGoCache 使用 go-cache 包实现的 TestCacheIfc 接口
 type TestGoCache struct {
-	cache *cache.Cache
+	cache             *cache.Cache
+	defaultExpiration time.Duration
+	cleanupInterval   time.Duration
+	budget            *byteBudget // nil 表示不限制内存
+	lock              sync.Mutex  // 有预算时保证预算和 go-cache 的写入、删除顺序一致
 }
 
 // NewTestGoCache 创建一个新的 TestGoCache 实例
 func NewTestGoCache(defaultExpiration, cleanupInterval time.Duration) *TestGoCache {
 	return &TestGoCache{
-		cache: cache.New(defaultExpiration, cleanupInterval),
+		cache:             cache.New(defaultExpiration, cleanupInterval),
+		defaultExpiration: defaultExpiration,
+		cleanupInterval:   cleanupInterval,
 	}
 }
 
+// NewTestGoCacheBounded 创建一个最多使用 budget 字节的 TestGoCache 实例，超出后先进先出淘汰
+// go-cache 删除和过期清理的 entry 通过 OnEvicted 从预算里减掉
+// 过期清理在 janitor goroutine 里不持有 lock，只减掉预算里仍是同一个值的 entry
+func NewTestGoCacheBounded(defaultExpiration, cleanupInterval time.Duration, budget int64) *TestGoCache {
+	g := NewTestGoCache(defaultExpiration, cleanupInterval)
+	g.budget = newByteBudget(budget)
+	g.cache.OnEvicted(func(key string, item interface{}) {
+		value, _ := item.(*TestStruct)
+		g.budget.removeValue(key, value)
+	})
+	return g
+}
+
 // Get 实现 TestCacheIfc.Get 方法
 func (g *TestGoCache) Get(key string) (*TestStruct, bool) {
 	item, found := g.cache.Get(key)
@@ -36,7 +58,83 @@ func (g *TestGoCache) Get(key string) (*TestStruct, bool) {
 
 // Set 实现 TestCacheIfc.Set 方法
 func (g *TestGoCache) Set(key string, value *TestStruct) error {
-	// 使用默认过期时间
-	g.cache.Set(key, value, cache.DefaultExpiration)
+	return g.set(key, value, cache.DefaultExpiration)
+}
+
+// set 先按预算淘汰，再写入，ttl 用 go-cache 的约定
+// 有预算时整个过程持有 lock，否则并发写同一个 key 时预算和 go-cache 里的值可能不一致
+func (g *TestGoCache) set(key string, value *TestStruct, ttl time.Duration) error {
+	if g.budget == nil {
+		g.cache.Set(key, value, ttl)
+		return nil
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	evict, err := g.budget.add(key, value, entryBudgetBytes(g, key, value))
+	if err != nil {
+		return err
+	}
+	g.cache.Set(key, value, ttl)
+	for _, k := range evict {
+		g.cache.Delete(k)
+	}
 	return nil
 }
+
+func (g *TestGoCache) Name() string {
+	return "GoCache"
+}
+
+// Config 实现 ConfigReporter.Config 方法
+func (g *TestGoCache) Config() string {
+	if g.budget != nil {
+		return fmt.Sprintf("defaultExpiration=%s cleanupInterval=%s budget=%d", g.defaultExpiration, g.cleanupInterval, g.budget.limit)
+	}
+	return fmt.Sprintf("defaultExpiration=%s cleanupInterval=%s", g.defaultExpiration, g.cleanupInterval)
+}
+
+// Capacity 实现 CapacityReporter.Capacity 方法，0 表示不限制
+func (g *TestGoCache) Capacity() int64 {
+	if g.budget == nil {
+		return 0
+	}
+	return g.budget.limit
+}
+
+// Evictions 实现 EvictionCounter.Evictions 方法
+func (g *TestGoCache) Evictions() int64 {
+	if g.budget == nil {
+		return 0
+	}
+	return g.budget.Evictions()
+}
+
+// Del 实现 Deleter.Del 方法
+func (g *TestGoCache) Del(key string) bool {
+	if g.budget != nil {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+	}
+	_, found := g.cache.Get(key)
+	g.cache.Delete(key)
+	return found
+}
+
+// SetWithTTL 实现 TTLSetter.SetWithTTL 方法，ttl <= 0 表示永不过期
+func (g *TestGoCache) SetWithTTL(key string, value *TestStruct, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+	return g.set(key, value, ttl)
+}
+
+// EntryCount 实现 EntryCounter.EntryCount 方法
+func (g *TestGoCache) EntryCount() int64 {
+	return int64(g.cache.ItemCount())
+}
+
+// EntryBytes 实现 EntryAccounter.EntryBytes 方法
+// 值和 TestMap 一样是散落的堆对象，header 是 map 里的 string + cache.Item
+func (g *TestGoCache) EntryBytes(key string, value *TestStruct) (int, int) {
+	return int(HeyiCacheFnTestStructIfc_.Size(value, true)), int(unsafe.Sizeof(key) + unsafe.Sizeof(cache.Item{}))
+}
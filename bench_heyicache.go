@@ -1,6 +1,10 @@
-package main
+package benchmark
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/yuadsl3010/heyicache"
 )
 
@@ -10,9 +14,15 @@ type TestHeyiCache struct {
 
 // NewTestHeyiCache 创建一个新的 TestHeyiCache 实例
 func NewTestHeyiCache(cacheSizeMB int) *TestHeyiCache {
+	return NewTestHeyiCacheOn(cacheSizeMB, nil)
+}
+
+// NewTestHeyiCacheOn 创建一个从 clock 读取时间的 TestHeyiCache 实例，clock 为 nil 时使用系统时间
+func NewTestHeyiCacheOn(cacheSizeMB int, clock Clock) *TestHeyiCache {
 	c, err := heyicache.NewCache(heyicache.Config{
-		Name:    "TestHeyiCache",
-		MaxSize: int64(cacheSizeMB),
+		Name:        "TestHeyiCache",
+		MaxSize:     int64(cacheSizeMB),
+		CustomTimer: clock,
 	})
 	if err != nil {
 		panic(err)
@@ -22,8 +32,58 @@ func NewTestHeyiCache(cacheSizeMB int) *TestHeyiCache {
 	}
 }
 
-// Get 实现 TestCacheIfc.Get 方法
-func (f *TestHeyiCache) Get(lease *heyicache.Lease, key string) (*TestStruct, bool) {
+func (f *TestHeyiCache) Name() string {
+	return "HeyiCache"
+}
+
+// heyicache 的 segment 和 block 个数，以及它能创建的最小 MaxSize
+const (
+	heyiCacheSegments = 256
+	heyiCacheBlocks   = 10
+	heyiCacheMinMB    = 32
+)
+
+// MaxEntryBytes 实现 EntryLimiter.MaxEntryBytes 方法
+// 每个 segment 分成 10 个 block，每个 entry 最多占 block 的 1/4
+func (f *TestHeyiCache) MaxEntryBytes() int {
+	return int(f.Capacity()/heyiCacheSegments/heyiCacheBlocks/4 - heyicache.ENTRY_HDR_SIZE)
+}
+
+// CopiesFlat 实现 FlatCopier.CopiesFlat 方法
+// heyicache 按值拷贝进 arena，带 heyicache:"skip" 的字段和 map 读出来是零值
+func (f *TestHeyiCache) CopiesFlat() bool {
+	return true
+}
+
+// Config 实现 ConfigReporter.Config 方法
+func (f *TestHeyiCache) Config() string {
+	return fmt.Sprintf("maxSizeMB=%d", f.Capacity()>>20)
+}
+
+// Evictions 实现 EvictionCounter.Evictions 方法
+func (f *TestHeyiCache) Evictions() int64 {
+	return f.Cache.EvictionNum()
+}
+
+// Capacity 实现 CapacityReporter.Capacity 方法
+func (f *TestHeyiCache) Capacity() int64 {
+	_, mem := f.Cache.MemStat()
+	return mem
+}
+
+// EntryCount 实现 EntryCounter.EntryCount 方法
+func (f *TestHeyiCache) EntryCount() int64 {
+	return f.Cache.EntryCount()
+}
+
+// EntryBytes 实现 EntryAccounter.EntryBytes 方法
+// arena 里的 entry header 加上 slot 里的 entryPtr
+func (f *TestHeyiCache) EntryBytes(key string, value *TestStruct) (int, int) {
+	return int(HeyiCacheFnTestStructIfc_.Size(value, true)), int(heyicache.ENTRY_HDR_SIZE) + heyicache.HASH_ENTRY_SIZE
+}
+
+// GetWithLease 在 lease 内读取，返回的值直接指向 heyicache 的 arena，lease Done 之后不可再用
+func (f *TestHeyiCache) GetWithLease(lease *heyicache.Lease, key string) (*TestStruct, bool) {
 	data, err := f.Cache.Get(lease, StringToByte(key), HeyiCacheFnTestStructIfc_)
 	if err != nil || data == nil {
 		return nil, false
@@ -32,11 +92,81 @@ func (f *TestHeyiCache) Get(lease *heyicache.Lease, key string) (*TestStruct, bo
 	return data.(*TestStruct), true
 }
 
+// Get 实现 TestCacheIfc.Get 方法
+// 没有请求作用域时只能把值拷贝出 arena 再归还 lease，压测走的是 Begin 的零拷贝路径
+func (f *TestHeyiCache) Get(key string) (*TestStruct, bool) {
+	ctx := heyicache.NewLeaseCtx(context.Background())
+	leaseCtx := heyicache.GetLeaseCtx(ctx)
+	defer leaseCtx.Done()
+
+	v, ok := f.GetWithLease(leaseCtx.GetLease(f.Cache), key)
+	if !ok {
+		return nil, false
+	}
+	return cloneTestStruct(v), true
+}
+
 // Set 实现 TestCacheIfc.Set 方法
 func (f *TestHeyiCache) Set(key string, value *TestStruct) error {
 	return f.Cache.Set(StringToByte(key), value, HeyiCacheFnTestStructIfc_, 0)
 }
 
+// Del 实现 Deleter.Del 方法
+func (f *TestHeyiCache) Del(key string) bool {
+	return f.Cache.Del(StringToByte(key))
+}
+
+// SetWithTTL 实现 TTLSetter.SetWithTTL 方法，heyicache 的过期时间精度为秒
+func (f *TestHeyiCache) SetWithTTL(key string, value *TestStruct, ttl time.Duration) error {
+	return f.Cache.Set(StringToByte(key), value, HeyiCacheFnTestStructIfc_, ttlSeconds(ttl))
+}
+
+// Expirations 实现 ExpirationCounter.Expirations 方法，heyicache 在 Get 时发现过期才计数
+func (f *TestHeyiCache) Expirations() int64 {
+	return f.Cache.ExpireCount()
+}
+
+// Begin 实现 Scoper.Begin 方法，一次请求对应一个 lease
+func (f *TestHeyiCache) Begin() RequestScope {
+	ctx := heyicache.NewLeaseCtx(context.Background())
+	leaseCtx := heyicache.GetLeaseCtx(ctx)
+	return &heyiCacheScope{
+		cache:    f,
+		leaseCtx: leaseCtx,
+		lease:    leaseCtx.GetLease(f.Cache),
+	}
+}
+
+type heyiCacheScope struct {
+	cache    *TestHeyiCache
+	leaseCtx *heyicache.LeaseCtx
+	lease    *heyicache.Lease
+}
+
+func (s *heyiCacheScope) Get(key string) (*TestStruct, bool) {
+	return s.cache.GetWithLease(s.lease, key)
+}
+
+func (s *heyiCacheScope) Peek(key string) (*TestStruct, bool) {
+	data, err := s.cache.Cache.Peek(s.lease, StringToByte(key), HeyiCacheFnTestStructIfc_)
+	if err != nil || data == nil {
+		return nil, false
+	}
+
+	return data.(*TestStruct), true
+}
+
+func (s *heyiCacheScope) Done() {
+	s.leaseCtx.Done()
+}
+
+// cloneTestStruct 用生成的 heyicache 函数把值拷贝到一块新的堆内存里
+func cloneTestStruct(v *TestStruct) *TestStruct {
+	bs := make([]byte, HeyiCacheFnTestStructIfc_.Size(v, true))
+	dst, _ := HeyiCacheFnTestStructIfc_.Set(v, bs, true)
+	return dst.(*TestStruct)
+}
+
 // func HeyiCacheFnGetTestStruct(data []byte) interface{} {
 // 	return nil
 // }
@@ -1,10 +1,33 @@
-package main
+package benchmark
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
 
+// TestMap 使用 map + 读写锁实现的 TestCacheIfc 接口
 type TestMap struct {
-	c    map[string]*TestStruct
-	lock sync.RWMutex
+	c      map[string]*TestStruct
+	lock   sync.RWMutex
+	size   int
+	budget *byteBudget // nil 表示不限制内存
+}
+
+// NewTestMap 创建一个新的 TestMap 实例
+func NewTestMap(size int) *TestMap {
+	return &TestMap{
+		c:    make(map[string]*TestStruct, size),
+		size: size,
+	}
+}
+
+// NewTestMapBounded 创建一个最多使用 budget 字节的 TestMap 实例，超出后先进先出淘汰
+// 每个 entry 按 EntryBytes 加上 key 的长度计算
+func NewTestMapBounded(size int, budget int64) *TestMap {
+	m := NewTestMap(size)
+	m.budget = newByteBudget(budget)
+	return m
 }
 
 func (m *TestMap) Get(key string) (*TestStruct, bool) {
@@ -17,6 +40,68 @@ func (m *TestMap) Get(key string) (*TestStruct, bool) {
 func (m *TestMap) Set(key string, value *TestStruct) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
+	if m.budget != nil {
+		evict, err := m.budget.add(key, value, entryBudgetBytes(m, key, value))
+		if err != nil {
+			return err
+		}
+		for _, k := range evict {
+			delete(m.c, k)
+		}
+	}
 	m.c[key] = value
 	return nil
 }
+
+func (m *TestMap) Name() string {
+	return "Map"
+}
+
+// Config 实现 ConfigReporter.Config 方法
+func (m *TestMap) Config() string {
+	if m.budget != nil {
+		return fmt.Sprintf("presize=%d budget=%d", m.size, m.budget.limit)
+	}
+	return fmt.Sprintf("presize=%d", m.size)
+}
+
+// Capacity 实现 CapacityReporter.Capacity 方法，0 表示不限制
+func (m *TestMap) Capacity() int64 {
+	if m.budget == nil {
+		return 0
+	}
+	return m.budget.limit
+}
+
+// Evictions 实现 EvictionCounter.Evictions 方法
+func (m *TestMap) Evictions() int64 {
+	if m.budget == nil {
+		return 0
+	}
+	return m.budget.Evictions()
+}
+
+// Del 实现 Deleter.Del 方法
+func (m *TestMap) Del(key string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.c[key]
+	delete(m.c, key)
+	if ok && m.budget != nil {
+		m.budget.remove(key)
+	}
+	return ok
+}
+
+// EntryCount 实现 EntryCounter.EntryCount 方法
+func (m *TestMap) EntryCount() int64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return int64(len(m.c))
+}
+
+// EntryBytes 实现 EntryAccounter.EntryBytes 方法
+// 值是一组散落在堆上的对象，这里用 heyicache 的平铺大小作为下限，header 是 map 里的 string + 指针
+func (m *TestMap) EntryBytes(key string, value *TestStruct) (int, int) {
+	return int(HeyiCacheFnTestStructIfc_.Size(value, true)), int(unsafe.Sizeof(key)) + ptrSize
+}
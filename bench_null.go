@@ -0,0 +1,36 @@
+package benchmark
+
+import "time"
+
+// TestNullCache 什么都不存的 TestCacheIfc 实现，Get 永远 miss
+// 同一个 workload 跑在它上面的耗时就是压测框架本身的开销：调度、key 的生成、计数
+type TestNullCache struct{}
+
+// NewTestNullCache 创建一个新的 TestNullCache 实例
+func NewTestNullCache() *TestNullCache {
+	return &TestNullCache{}
+}
+
+// Get 实现 TestCacheIfc.Get 方法
+func (n *TestNullCache) Get(key string) (*TestStruct, bool) {
+	return nil, false
+}
+
+// Set 实现 TestCacheIfc.Set 方法
+func (n *TestNullCache) Set(key string, value *TestStruct) error {
+	return nil
+}
+
+func (n *TestNullCache) Name() string {
+	return "Null"
+}
+
+// Del 实现 Deleter.Del 方法
+func (n *TestNullCache) Del(key string) bool {
+	return false
+}
+
+// SetWithTTL 实现 TTLSetter.SetWithTTL 方法
+func (n *TestNullCache) SetWithTTL(key string, value *TestStruct, ttl time.Duration) error {
+	return nil
+}
@@ -0,0 +1,142 @@
+package benchmark
+
+import (
+	"errors"
+	"sync"
+)
+
+// errOverBudget is returned when one entry is larger than the whole budget
+var errOverBudget = errors.New("entry larger than the memory budget")
+
+// byteBudget bounds the bytes of a cache that doesn't bound itself: it
+// accounts every entry and evicts the oldest ones, first in first out like
+// heyicache's and freecache's ring buffers, until the new one fits
+type byteBudget struct {
+	mu        sync.Mutex
+	limit     int64
+	used      int64
+	entries   map[string]budgetEntry
+	queue     []budgetKey // insertion order, the entries removed since are skipped
+	head      int
+	seq       uint64
+	evictions int64
+}
+
+type budgetEntry struct {
+	bytes int64
+	seq   uint64
+	value *TestStruct // the value accounted, see removeValue
+}
+
+type budgetKey struct {
+	key string
+	seq uint64
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, entries: make(map[string]budgetEntry)}
+}
+
+// add accounts key holding value with bytes and returns the keys to evict to
+// stay within the limit, an entry replaced keeps its place in the queue
+func (b *byteBudget) add(key string, value *TestStruct, bytes int64) (evict []string, err error) {
+	if bytes > b.limit {
+		return nil, errOverBudget
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.entries[key]; ok {
+		b.used += bytes - e.bytes
+		b.entries[key] = budgetEntry{bytes: bytes, seq: e.seq, value: value}
+	} else {
+		b.seq++
+		b.used += bytes
+		b.entries[key] = budgetEntry{bytes: bytes, seq: b.seq, value: value}
+		b.queue = append(b.queue, budgetKey{key: key, seq: b.seq})
+	}
+	for b.used > b.limit && b.head < len(b.queue) {
+		k := b.queue[b.head]
+		b.queue[b.head] = budgetKey{}
+		b.head++
+		e, ok := b.entries[k.key]
+		if !ok || e.seq != k.seq {
+			continue
+		}
+		if k.key == key {
+			// the entry being replaced is the oldest, it stays
+			b.queue = append(b.queue, k)
+			continue
+		}
+		b.used -= e.bytes
+		delete(b.entries, k.key)
+		evict = append(evict, k.key)
+		b.evictions++
+	}
+	b.compact()
+	return evict, nil
+}
+
+// compact drops the consumed head of the queue and, when the removed entries
+// make up most of it, their keys
+func (b *byteBudget) compact() {
+	if b.head > len(b.queue)/2 {
+		b.queue = append(b.queue[:0], b.queue[b.head:]...)
+		b.head = 0
+	}
+	if len(b.queue) > 2*len(b.entries)+1024 {
+		live := b.queue[:0]
+		for _, k := range b.queue[b.head:] {
+			if e, ok := b.entries[k.key]; ok && e.seq == k.seq {
+				live = append(live, k)
+			}
+		}
+		clear(b.queue[len(live):])
+		b.queue = live
+		b.head = 0
+	}
+}
+
+// remove forgets key, deleted or expired
+func (b *byteBudget) remove(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.entries[key]; ok {
+		b.forget(key, e)
+	}
+}
+
+// removeValue forgets key when it still holds value, a cache that reports
+// its removals late may report a value that was replaced since
+func (b *byteBudget) removeValue(key string, value *TestStruct) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.entries[key]; ok && e.value == value {
+		b.forget(key, e)
+	}
+}
+
+func (b *byteBudget) forget(key string, e budgetEntry) {
+	b.used -= e.bytes
+	delete(b.entries, key)
+	b.compact()
+}
+
+func (b *byteBudget) Evictions() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.evictions
+}
+
+// Used returns the bytes accounted to the entries in the cache
+func (b *byteBudget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// entryBudgetBytes is what one entry costs against a byteBudget: the key and
+// what the cache accounts for the value and its header
+func entryBudgetBytes(c EntryAccounter, key string, value *TestStruct) int64 {
+	payload, header := c.EntryBytes(key, value)
+	return int64(len(key) + payload + header)
+}
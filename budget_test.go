@@ -0,0 +1,81 @@
+package benchmark
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestByteBudget(t *testing.T) {
+	b := newByteBudget(100)
+	for i := 0; i < 4; i++ {
+		if evict, err := b.add(fmt.Sprint(i), nil, 25); err != nil || len(evict) > 0 {
+			t.Fatalf("add %d: evicted %v, %v", i, evict, err)
+		}
+	}
+	// replacing the oldest entry keeps it, the next oldest goes
+	if evict, _ := b.add("0", nil, 40); len(evict) != 1 || evict[0] != "1" {
+		t.Fatalf("evicted %v, want [1]", evict)
+	}
+	b.remove("2")
+	if evict, _ := b.add("4", nil, 50); len(evict) != 1 || evict[0] != "3" {
+		t.Fatalf("evicted %v, want [3]", evict)
+	}
+	if b.Used() != 90 || b.Evictions() != 2 {
+		t.Fatalf("used %d evictions %d", b.Used(), b.Evictions())
+	}
+	if _, err := b.add("5", nil, 101); err != errOverBudget {
+		t.Fatalf("got %v for an entry over the budget", err)
+	}
+	// a removal reported for a replaced value keeps the new one
+	_, v1 := NewTestStruct(1)
+	_, v2 := NewTestStruct(2)
+	b.add("6", v1, 5)
+	b.add("6", v2, 5)
+	if b.removeValue("6", v1); b.Used() != 95 {
+		t.Fatalf("used %d after removing the replaced value", b.Used())
+	}
+	if b.removeValue("6", v2); b.Used() != 90 {
+		t.Fatalf("used %d after removing the value", b.Used())
+	}
+	// deletes don't grow the queue for ever
+	for i := 0; i < 10000; i++ {
+		b.add("k", nil, 1)
+		b.remove("k")
+	}
+	if len(b.queue) > 2*len(b.entries)+1024 {
+		t.Fatalf("%d keys queued for %d entries", len(b.queue), len(b.entries))
+	}
+}
+
+// TestBoundedAdapters fills the map and go-cache past their budget
+func TestBoundedAdapters(t *testing.T) {
+	const budget = 1 << 20
+	for _, cache := range []CacheAdapter{
+		NewTestMapBounded(0, budget),
+		NewTestGoCacheBounded(time.Minute, time.Minute, budget),
+	} {
+		for id := 0; id < 5000; id++ {
+			k, v := NewTestStruct(id)
+			if err := cache.Set(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries := cache.(EntryCounter).EntryCount()
+		evictions := cache.(EvictionCounter).Evictions()
+		if evictions == 0 || entries+evictions != 5000 {
+			t.Errorf("%s: %d entries and %d evictions", cache.Name(), entries, evictions)
+		}
+		// the oldest are gone, the newest stay
+		if _, ok := cache.Get(GetKey(0)); ok {
+			t.Errorf("%s: the first record wasn't evicted", cache.Name())
+		}
+		if _, ok := cache.Get(GetKey(4999)); !ok {
+			t.Errorf("%s: the last record was evicted", cache.Name())
+		}
+		if d, ok := cache.(Deleter); ok && !d.Del(GetKey(4999)) {
+			t.Errorf("%s: can't delete the last record", cache.Name())
+		}
+		closeCache(cache)
+	}
+}
@@ -0,0 +1,44 @@
+package benchmark
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Calibrate runs wl against the null cache for d: the cost of the harness
+// alone. The null cache misses every read, so it doesn't account for the
+// comparison of a verification. Calibrating only makes sense in closed loop
+// mode, an open loop run idles between its operations
+func Calibrate(wl Workload, d time.Duration) (*BenchResult, error) {
+	return runFor(NewTestNullCache(), wl, d)
+}
+
+// Calibrated records the harness cost null measured in result, its metrics
+// then have the overhead subtracted
+func (result *BenchResult) Calibrated(null *BenchResult) *BenchResult {
+	result.NullNs = null.CPUNsPerOp()
+	return result
+}
+
+// BenchCalibrated is BenchWorkload with the same b.N requests first run
+// against the null cache before the timer starts
+func BenchCalibrated(b *testing.B, ifc CacheAdapter, wl Workload) {
+	if err := wl.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	if err := checkCapabilities(ifc, &wl); err != nil {
+		b.Skip(err)
+	}
+	b.Cleanup(func() { closeCache(ifc) })
+	null := NewTestNullCache()
+	wl.Prepare()
+	if wl.Preload {
+		LoadRecords(null, &wl)
+		LoadRecords(ifc, &wl)
+	}
+	nullResult := RunWorkload(null, &wl, b.N)
+	runtime.GC()
+	b.ResetTimer()
+	RunWorkload(ifc, &wl, b.N).Calibrated(nullResult).Report(b)
+}
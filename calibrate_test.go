@@ -0,0 +1,74 @@
+package benchmark
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCalibrate(t *testing.T) {
+	wl := DefaultWorkload
+	wl.Goroutines = 4
+	wl.Records = 1000
+	null, err := Calibrate(wl, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if null.Ops() == 0 || null.ReadSuccess != 0 {
+		t.Fatalf("null cache: %d ops, %d hits", null.Ops(), null.ReadSuccess)
+	}
+
+	result, err := runFor(NewTestMap(wl.Records), wl, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]float64{}
+	for _, m := range result.Calibrated(null).Metrics() {
+		metrics[m.Name] = m.Value
+	}
+	cpu, net := metrics["cpu-ns/op"], metrics["net-ns/op"]
+	if cpu <= 0 || metrics["null-ns/op"] != null.CPUNsPerOp() || net != max(cpu-null.CPUNsPerOp(), 0) {
+		t.Fatalf("unexpected calibrated metrics %v", metrics)
+	}
+}
+
+// TestCPUTime checks the CPU time is measured, not the wall time of every P:
+// one goroutine keeps one busy, the runtime's own work adds a bit to it
+func TestCPUTime(t *testing.T) {
+	wl := DefaultWorkload
+	wl.Goroutines = 1
+	wl.Records = 1000
+	result, err := runFor(NewTestMap(wl.Records), wl, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.CPU <= 0 || result.CPU > result.Elapsed*3/2 {
+		t.Fatalf("%s CPU in %s", result.CPU, result.Elapsed)
+	}
+	if got, want := result.CPUNsPerOp(), float64(result.CPU)/float64(result.Ops()); got != want {
+		t.Fatalf("cpu-ns/op %f, want %f", got, want)
+	}
+}
+
+func TestCalibrateOpenLoop(t *testing.T) {
+	cfg, err := ParseCLI([]string{"-calibrate", "-rate", "1000", "-caches", "map", "-duration", "10ms"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Run(io.Discard); err == nil {
+		t.Fatal("calibrating an open loop run was accepted")
+	}
+}
+
+func TestSelectNullAdapter(t *testing.T) {
+	factories, err := SelectAdapters("map,null", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(factories) != 2 || factories[1].Name != "Null" {
+		t.Fatalf("unexpected factories %v", factories)
+	}
+	if _, err := SelectAdapters("null", 64); err == nil {
+		t.Fatal("the null cache can't be sized")
+	}
+}
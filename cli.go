@@ -0,0 +1,691 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Duration is a time.Duration written as "10s" in config files and flags
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+// CLIConfig is everything heyibench can be told, from a JSON config file
+// (-config) or from flags, flags win over the file. Zero numbers keep the
+// value of the workload preset
+type CLIConfig struct {
+	Mode     string `json:"mode"`     // run, sweep, capacity, memory, replay, compare or report
+	Caches   string `json:"caches"`   // comma separated cache names, "all" for every cache
+	Capacity int    `json:"capacity"` // memory budget in MB given to every cache, 0 keeps the default configuration
+	Codecs   string `json:"codecs"`   // comma separated codecs every byte cache is run with, see ParseCodec
+
+	Workload      string   `json:"workload"`    // preset name
+	Mix           string   `json:"mix"`         // read,write,delete,verify,peek percentages, overrides the preset
+	Keys          string   `json:"keys"`        // key distribution, see ParseKeyDistribution
+	Values        string   `json:"values"`      // value profile, see ValueProfiles
+	Pool          string   `json:"pool"`        // off, pregenerate or memoize, see PoolMode
+	LeaseCheck    string   `json:"lease_check"` // off, during or after, see LeaseCheck
+	TTL           string   `json:"ttl"`         // ttl distribution, see ParseTTLDistribution
+	SimTick       Duration `json:"sim_tick"`    // simulated time per operation, 0 runs on the system clock
+	Records       int      `json:"records"`
+	Goroutines    int      `json:"goroutines"`
+	OpsPerRequest int      `json:"ops_per_request"`
+	Duration      Duration `json:"duration"`
+	Rate          float64  `json:"rate"`    // open loop operations per second, 0 runs closed loop
+	Arrival       string   `json:"arrival"` // constant or poisson
+	Seed          uint64   `json:"seed"`
+	Preload       bool     `json:"preload"`
+	FillOnMiss    bool     `json:"fill_on_miss"`
+	AppLoad       bool     `json:"app_load"`
+	Calibrate     bool     `json:"calibrate"` // run the null cache first and subtract its cost
+
+	SweepFactor   int     `json:"sweep_factor"`
+	MemoryEntries int     `json:"memory_entries"`
+	Trace         string  `json:"trace"`
+	TraceFormat   string  `json:"trace_format"`
+	TraceSpeed    float64 `json:"trace_speed"`
+
+	Count     int     `json:"count"`     // repetitions of every run
+	Baseline  string  `json:"baseline"`  // result document compared against by the compare mode
+	Inputs    string  `json:"inputs"`    // comma separated result files the report mode draws
+	Save      string  `json:"save"`      // where the compare mode stores its new result document
+	Threshold float64 `json:"threshold"` // percent of throughput drop or p99 rise that fails the compare mode
+	Alpha     float64 `json:"alpha"`     // significance level of the comparison
+
+	Format string `json:"format"` // text, json, csv or benchstat
+	Out    string `json:"out"`    // output file, stdout when empty
+}
+
+func defaultCLIConfig() CLIConfig {
+	return CLIConfig{
+		Mode:          "run",
+		Caches:        "all",
+		Workload:      "default",
+		Duration:      Duration(10 * time.Second),
+		Arrival:       ArrivalConstant.String(),
+		Preload:       true,
+		SweepFactor:   4,
+		MemoryEntries: 50000,
+		Count:         1,
+		Threshold:     5,
+		Alpha:         0.05,
+		Format:        "text",
+	}
+}
+
+// bindFlags registers a flag for every field of cfg
+func bindFlags(fs *flag.FlagSet, cfg *CLIConfig) *string {
+	configPath := fs.String("config", "", "JSON config file, flags override its values")
+	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "run, sweep (throughput per goroutines), capacity (hit ratio per capacity), memory (bytes per entry), replay (a trace), compare (rerun a baseline) or report (HTML charts of result files)")
+	fs.StringVar(&cfg.Caches, "caches", cfg.Caches, "comma separated caches: "+strings.Join(adapterNames(), ", ")+" or all")
+	fs.IntVar(&cfg.Capacity, "capacity", cfg.Capacity, "memory budget in MB given to every cache, 0 keeps the default configuration")
+	fs.StringVar(&cfg.Codecs, "codecs", cfg.Codecs, "comma separated codecs freecache and bigcache are run with, one run per codec: "+strings.Join(CodecNames(), ", ")+", any of them +flate or +zlib, or all")
+	fs.StringVar(&cfg.Workload, "workload", cfg.Workload, "workload preset: "+strings.Join(PresetNames(), ", "))
+	fs.StringVar(&cfg.Mix, "mix", cfg.Mix, "read,write,delete,verify,peek percentages, overrides the preset")
+	fs.StringVar(&cfg.Keys, "keys", cfg.Keys, "key distribution: uniform, zipfian-0.99, hotspot-20-80, latest-0.99, sequential or sequential-shared")
+	fs.StringVar(&cfg.Values, "values", cfg.Values, "value profile: "+strings.Join(ValueProfileNames(), ", "))
+	fs.StringVar(&cfg.LeaseCheck, "lease-check", cfg.LeaseCheck, "check the values read for changes: off, during (after every operation of the lease and before its Done) or after (past Done, under eviction pressure)")
+	fs.StringVar(&cfg.TTL, "ttl", cfg.TTL, "ttl of the records: fixed-30s, uniform-10s-5m or exp-1m, empty never expires")
+	fs.Var(&cfg.SimTick, "sim-tick", "simulated time every operation takes, the caches expire their entries on that clock instead of the system's (freecache and heyicache only), 0 runs on the system clock")
+	fs.StringVar(&cfg.Pool, "pool", cfg.Pool, "build keys and values before the run: off, pregenerate or memoize")
+	fs.IntVar(&cfg.Records, "records", cfg.Records, "number of records, 0 keeps the preset")
+	fs.IntVar(&cfg.Goroutines, "goroutines", cfg.Goroutines, "concurrent clients, 0 keeps the preset")
+	fs.IntVar(&cfg.OpsPerRequest, "ops-per-request", cfg.OpsPerRequest, "operations per request scope, 0 keeps the preset")
+	fs.Var(&cfg.Duration, "duration", "duration of every run")
+	fs.Float64Var(&cfg.Rate, "rate", cfg.Rate, "open loop operations per second, 0 runs closed loop")
+	fs.StringVar(&cfg.Arrival, "arrival", cfg.Arrival, "open loop arrivals: constant or poisson")
+	fs.Uint64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the random sources")
+	fs.BoolVar(&cfg.Preload, "preload", cfg.Preload, "set every record before the run")
+	fs.BoolVar(&cfg.FillOnMiss, "fill-on-miss", cfg.FillOnMiss, "set the record after a read misses")
+	fs.BoolVar(&cfg.AppLoad, "app-load", cfg.AppLoad, "run an allocating application goroutine next to the cache")
+	fs.BoolVar(&cfg.Calibrate, "calibrate", cfg.Calibrate, "run every workload against the null cache first and report the results with its cost subtracted")
+	fs.IntVar(&cfg.SweepFactor, "sweep-factor", cfg.SweepFactor, "the sweep goes up to sweep-factor*GOMAXPROCS goroutines")
+	fs.IntVar(&cfg.MemoryEntries, "memory-entries", cfg.MemoryEntries, "entries written by the memory mode")
+	fs.StringVar(&cfg.Trace, "trace", cfg.Trace, "trace replayed by the replay mode")
+	fs.StringVar(&cfg.TraceFormat, "trace-format", cfg.TraceFormat, "format of the trace: "+strings.Join(TraceFormats, ", ")+", guessed from the extension when empty")
+	fs.Float64Var(&cfg.TraceSpeed, "trace-speed", cfg.TraceSpeed, "replay speed relative to the recorded time, 0 replays as fast as possible")
+	fs.IntVar(&cfg.Count, "count", cfg.Count, "repetitions of every run, compare needs 4 or more on both sides to find differences significant at -alpha 0.05")
+	fs.StringVar(&cfg.Baseline, "baseline", cfg.Baseline, "result document (-format json) the compare mode reruns and compares against")
+	fs.StringVar(&cfg.Inputs, "inputs", cfg.Inputs, "comma separated JSON result files (run, sweep, capacity, memory) the report mode draws")
+	fs.StringVar(&cfg.Save, "save", cfg.Save, "file the compare mode writes its new result document to")
+	fs.Float64Var(&cfg.Threshold, "threshold", cfg.Threshold, "percent of throughput drop or p99 rise that makes compare exit with 2")
+	fs.Float64Var(&cfg.Alpha, "alpha", cfg.Alpha, "significance level of the comparison")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "output format: text, json, csv or benchstat (go test -bench lines)")
+	fs.StringVar(&cfg.Out, "out", cfg.Out, "output file, stdout when empty")
+	return configPath
+}
+
+// ParseCLI reads the config file named by -config, if any, then applies the
+// flags on top of it
+func ParseCLI(args []string, stderr io.Writer) (*CLIConfig, error) {
+	// the first pass only looks for -config, the second one overrides the
+	// values of the file with the flags that were given
+	scan := defaultCLIConfig()
+	fs := flag.NewFlagSet("heyibench", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configPath := bindFlags(fs, &scan)
+	if err := fs.Parse(args); err != nil {
+		fs.SetOutput(stderr)
+		fs.Usage()
+		return nil, err
+	}
+
+	cfg := defaultCLIConfig()
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("config %s: %v", *configPath, err)
+		}
+	}
+	fs = flag.NewFlagSet("heyibench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	bindFlags(fs, &cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return &cfg, nil
+}
+
+// BuildWorkload applies the overrides of cfg to its preset
+func (cfg *CLIConfig) BuildWorkload() (Workload, error) {
+	wl, ok := WorkloadPresets[cfg.Workload]
+	if !ok {
+		return wl, fmt.Errorf("unknown workload %q, want one of %s", cfg.Workload, strings.Join(PresetNames(), ", "))
+	}
+	return cfg.override(wl)
+}
+
+// capacityWorkload applies the overrides of cfg to CapacityWorkload. It keeps
+// filling the misses, without them the hit rate doesn't trace the miss ratio
+// curve
+func (cfg *CLIConfig) capacityWorkload() (Workload, error) {
+	if cfg.Workload != defaultCLIConfig().Workload {
+		return Workload{}, fmt.Errorf("capacity mode runs its own workload, tune it with -mix, -keys and -values instead of -workload")
+	}
+	if cfg.SimTick != 0 {
+		return Workload{}, fmt.Errorf("capacity mode runs on the system clock, -sim-tick can't be used")
+	}
+	wl, err := cfg.override(CapacityWorkload)
+	if err != nil {
+		return wl, err
+	}
+	wl.FillOnMiss = true
+	return wl, wl.Validate()
+}
+
+// override applies the overrides of cfg to wl
+func (cfg *CLIConfig) override(wl Workload) (Workload, error) {
+	if cfg.Mix != "" {
+		parts := strings.Split(cfg.Mix, ",")
+		if len(parts) != 5 {
+			return wl, fmt.Errorf("mix %q: want read,write,delete,verify,peek", cfg.Mix)
+		}
+		var mix [5]float64
+		for i, p := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return wl, fmt.Errorf("mix %q: %v", cfg.Mix, err)
+			}
+			mix[i] = v
+		}
+		wl = wl.WithMix(wl.Name, mix[0], mix[1], mix[2], mix[3], mix[4])
+	}
+	if cfg.Keys != "" {
+		d, err := ParseKeyDistribution(cfg.Keys)
+		if err != nil {
+			return wl, err
+		}
+		wl.Keys = d
+	}
+	if cfg.Values != "" && cfg.Values != "default" {
+		if wl.Values = ValueProfiles[cfg.Values]; wl.Values == nil {
+			return wl, fmt.Errorf("unknown value profile %q, want one of %s", cfg.Values, strings.Join(ValueProfileNames(), ", "))
+		}
+	}
+	pool, err := ParsePoolMode(cfg.Pool)
+	if err != nil {
+		return wl, err
+	}
+	wl.Pool = pool
+	if wl.LeaseCheck, err = ParseLeaseCheck(cfg.LeaseCheck); err != nil {
+		return wl, err
+	}
+	if cfg.Records > 0 {
+		wl.Records = cfg.Records
+	}
+	if cfg.Goroutines > 0 {
+		wl.Goroutines = cfg.Goroutines
+	}
+	if cfg.OpsPerRequest > 0 {
+		wl.OpsPerRequest = cfg.OpsPerRequest
+	}
+	if cfg.Rate > 0 {
+		arrival, err := parseArrival(cfg.Arrival)
+		if err != nil {
+			return wl, err
+		}
+		wl = wl.WithRate(cfg.Rate, arrival)
+	}
+	if cfg.TTL != "" {
+		ttl, err := ParseTTLDistribution(cfg.TTL)
+		if err != nil {
+			return wl, err
+		}
+		wl = wl.WithTTL(ttl, time.Duration(cfg.SimTick))
+	} else if cfg.SimTick != 0 {
+		return wl, fmt.Errorf("-sim-tick needs -ttl")
+	}
+	wl.Seed = cfg.Seed
+	wl.Preload = cfg.Preload
+	wl.FillOnMiss = cfg.FillOnMiss
+	wl.AppLoad = cfg.AppLoad
+	return wl, wl.Validate()
+}
+
+func parseArrival(s string) (Arrival, error) {
+	for _, a := range []Arrival{ArrivalConstant, ArrivalPoisson} {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown arrival %q, want constant or poisson", s)
+}
+
+func adapterNames() []string {
+	names := make([]string, 0, len(Adapters))
+	for _, factory := range Adapters {
+		names = append(names, factory.Name)
+	}
+	return append(names, NullAdapter.Name)
+}
+
+// SelectAdapters picks the caches named in the comma separated list, case
+// insensitive. With capacity > 0 (MB) only the sized caches can be picked,
+// the ones that can't be built that small (see MinCapacity) are left out of
+// all and refused when named
+func SelectAdapters(list string, capacity int) ([]AdapterFactory, error) {
+	all := Adapters
+	tooSmall := map[string]int64{}
+	if capacity > 0 {
+		all = nil
+		for _, sized := range SizedAdapters {
+			if min := MinCapacity[sized.Name]; int64(capacity)<<20 < min {
+				tooSmall[strings.ToLower(sized.Name)] = min
+				continue
+			}
+			all = append(all, sized.WithCapacity(int64(capacity)<<20))
+		}
+	}
+	if list == "" || list == "all" {
+		return all, nil
+	}
+	var factories []AdapterFactory
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if capacity <= 0 && strings.EqualFold(name, NullAdapter.Name) {
+			factories = append(factories, NullAdapter)
+			continue
+		}
+		// FreeCache/gob picks a codec
+		name, codecName, withCodec := strings.Cut(name, "/")
+		if min, ok := tooSmall[strings.ToLower(name)]; ok {
+			return nil, fmt.Errorf("cache %q can't be built with less than %dMB, -capacity is %dMB", name, min>>20, capacity)
+		}
+		found := false
+		for _, factory := range all {
+			if !strings.EqualFold(factory.Name, name) {
+				continue
+			}
+			if withCodec {
+				if !slices.Contains(CodecAdapters, factory.Name) {
+					return nil, fmt.Errorf("cache %q doesn't encode its values", factory.Name)
+				}
+				codec, err := ParseCodec(codecName)
+				if err != nil {
+					return nil, err
+				}
+				factory = factory.WithCodec(codec)
+			}
+			factories = append(factories, factory)
+			found = true
+			break
+		}
+		if !found {
+			if capacity > 0 {
+				return nil, fmt.Errorf("cache %q can't be sized", name)
+			}
+			return nil, fmt.Errorf("unknown cache %q, want one of %s", name, strings.Join(adapterNames(), ", "))
+		}
+	}
+	return factories, nil
+}
+
+// RunCLI runs heyibench with args and returns the exit code
+func RunCLI(args []string, stdout, stderr io.Writer) int {
+	cfg, err := ParseCLI(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err == nil {
+		err = cfg.Run(stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "heyibench:", err)
+		if errors.Is(err, ErrRegression) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// Run runs the mode of cfg and writes its table
+func (cfg *CLIConfig) Run(stdout io.Writer) (err error) {
+	switch cfg.Format {
+	case "text", "json", "csv", "benchstat":
+	default:
+		return fmt.Errorf("unknown format %q, want text, json, csv or benchstat", cfg.Format)
+	}
+	if cfg.Mode == "report" {
+		return cfg.report(stdout)
+	}
+	factories, err := SelectAdapters(cfg.Caches, cfg.Capacity)
+	if err != nil {
+		return err
+	}
+	codecs, err := ParseCodecs(cfg.Codecs)
+	if err != nil {
+		return err
+	}
+	factories = WithCodecs(factories, codecs)
+	wl, err := cfg.BuildWorkload()
+	if err != nil {
+		return err
+	}
+	if factories, err = withSimClock(factories, &wl, cfg.Caches == "" || cfg.Caches == "all"); err != nil {
+		return err
+	}
+	d := time.Duration(cfg.Duration)
+
+	var table csvTable
+	params := wl.Params()
+	switch cfg.Mode {
+	case "run":
+		table, err = cfg.runRepeated(factories, []Workload{wl}, nil)
+	case "replay":
+		if cfg.Trace == "" {
+			return fmt.Errorf("replay needs -trace")
+		}
+		trace, err := LoadTrace(cfg.Trace, cfg.TraceFormat)
+		if err != nil {
+			return err
+		}
+		wl.Name = "replay"
+		table, err = cfg.runRepeated(factories, []Workload{wl}, trace)
+		if err != nil {
+			return err
+		}
+	case "compare":
+		var comparisons Comparisons
+		comparisons, err = cfg.compare()
+		if err == nil && len(comparisons.Regressions()) > 0 {
+			// the table is still written, the regressions decide the exit code
+			defer func() {
+				if err == nil {
+					err = fmt.Errorf("%w: %d metrics past %g%%", ErrRegression, len(comparisons.Regressions()), cfg.Threshold)
+				}
+			}()
+		}
+		table = comparisons
+	case "sweep":
+		table, err = ConcurrencySweep(factories, wl, SweepSteps(cfg.SweepFactor), d)
+	case "capacity":
+		var sized []SizedAdapterFactory
+		for _, factory := range factories {
+			for _, s := range SizedAdapters {
+				if s.Name == factory.Name {
+					sized = append(sized, s)
+				}
+			}
+		}
+		var capWl Workload
+		if capWl, err = cfg.capacityWorkload(); err != nil {
+			return err
+		}
+		params = capWl.Params()
+		table, err = CapacitySweep(sized, capWl, CapacityPercents, d)
+	case "memory":
+		table, err = MeasureMemoryAll(factories, cfg.MemoryEntries)
+	default:
+		return fmt.Errorf("unknown mode %q, want run, sweep, capacity, memory, replay, compare or report", cfg.Mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	out := stdout
+	if cfg.Out != "" {
+		f, err := os.Create(cfg.Out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	switch cfg.Mode {
+	case "memory", "compare":
+		err = writeOutput(out, cfg.Format, table, nil)
+	default:
+		err = writeOutput(out, cfg.Format, table, &params)
+	}
+	if err != nil {
+		return err
+	}
+	if f, ok := out.(*os.File); ok && cfg.Out != "" {
+		return f.Close()
+	}
+	return nil
+}
+
+// runRepeated runs every workload against a fresh instance of every cache
+// cfg.Count times, or replays trace when it's not nil
+func (cfg *CLIConfig) runRepeated(factories []AdapterFactory, workloads []Workload, trace *Trace) (*ResultDocument, error) {
+	doc := NewResultDocument()
+	doc.Settings = RunSettings{Duration: time.Duration(cfg.Duration).Seconds(), Capacity: cfg.Capacity}
+	for i := range workloads {
+		wl := &workloads[i]
+		if cfg.Calibrate && (wl.Rate > 0 || trace != nil && cfg.TraceSpeed > 0) {
+			return nil, fmt.Errorf("calibrate needs a closed loop run, an open loop one idles between its operations")
+		}
+		var null *BenchResult
+		if cfg.Calibrate {
+			cache := NewTestNullCache()
+			result, err := cfg.runOnce(cache, wl, trace)
+			if err != nil {
+				return nil, fmt.Errorf("calibrate: %v", err)
+			}
+			doc.Runs = append(doc.Runs, NewRunDocument(cache, wl, result))
+			null = result
+		}
+		// the pool is built once, before the heap of the caches is measured
+		wl.Prepare()
+		for _, factory := range factories {
+			for n := 0; n < max(cfg.Count, 1); n++ {
+				heapBase, _ := memSnapshot()
+				cache, err := factory.New()
+				if err != nil {
+					return nil, fmt.Errorf("create %s: %v", factory.Name, err)
+				}
+				result, err := cfg.runOnce(cache, wl, trace)
+				if err == nil {
+					result.measureResident(cache, heapBase)
+					if null != nil {
+						result.Calibrated(null)
+					}
+					doc.Runs = append(doc.Runs, NewRunDocument(cache, wl, result))
+				}
+				closeCache(cache)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return doc, nil
+}
+
+// runOnce runs wl against cache for cfg.Duration, or replays trace when it's
+// not nil
+func (cfg *CLIConfig) runOnce(cache CacheAdapter, wl *Workload, trace *Trace) (*BenchResult, error) {
+	if trace != nil {
+		return ReplayTrace(cache, wl, trace, cfg.TraceSpeed)
+	}
+	return runFor(cache, *wl, time.Duration(cfg.Duration))
+}
+
+// compare reruns every run of the baseline with its cache, workload, duration
+// and capacity, the trace comes from cfg. The caches of one workload are rerun
+// together so a calibrated baseline gets one null run per workload. It fails
+// when a cache doesn't get the capacity it had in the baseline, or when the
+// repetitions can't give a significant difference at cfg.Alpha
+func (cfg *CLIConfig) compare() (Comparisons, error) {
+	if cfg.Baseline == "" {
+		return nil, fmt.Errorf("compare needs -baseline")
+	}
+	if cfg.Alpha <= 0 || cfg.Alpha >= 1 {
+		return nil, fmt.Errorf("-alpha must be between 0 and 1")
+	}
+	baseline, err := LoadResultDocument(cfg.Baseline)
+	if err != nil {
+		return nil, err
+	}
+	rerun := *cfg
+	rerun.Capacity = baseline.Settings.Capacity
+	if d := baseline.Settings.Duration; d > 0 {
+		rerun.Duration = Duration(d * float64(time.Second))
+	}
+	count := max(cfg.Count, 1)
+	samples := map[string]int{}
+	for _, run := range baseline.Runs {
+		samples[run.Name]++
+	}
+	// the caches of every workload, in the order of the baseline
+	var workloads []WorkloadParams
+	caches := map[WorkloadParams][]string{}
+	for _, run := range baseline.Runs {
+		if cfg.Calibrate && run.Cache.Name == NullAdapter.Name {
+			continue
+		}
+		names := caches[run.Workload]
+		if slices.Contains(names, run.Cache.Name) {
+			continue
+		}
+		if p := minP(samples[run.Name], count); p >= cfg.Alpha {
+			return nil, fmt.Errorf("%s: %d baseline and %d new repetitions can't give p < %g, the lowest is %.3g: run both with -count %d or more",
+				run.Name, samples[run.Name], count, cfg.Alpha, p, minCount(cfg.Alpha))
+		}
+		if names == nil {
+			workloads = append(workloads, run.Workload)
+		}
+		caches[run.Workload] = append(names, run.Cache.Name)
+	}
+	capacities := map[string]int64{}
+	for _, run := range baseline.Runs {
+		capacities[run.Name] = run.Cache.Capacity
+	}
+	var trace *Trace
+	cur := NewResultDocument()
+	for _, params := range workloads {
+		factories, err := SelectAdapters(strings.Join(caches[params], ","), rerun.Capacity)
+		if err != nil {
+			return nil, err
+		}
+		wl, err := params.Workload()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", params.Name, err)
+		}
+		var runTrace *Trace
+		if wl.Name == "replay" {
+			if cfg.Trace == "" {
+				return nil, fmt.Errorf("%s: comparing a replay needs -trace", params.Name)
+			}
+			if trace == nil {
+				if trace, err = LoadTrace(cfg.Trace, cfg.TraceFormat); err != nil {
+					return nil, err
+				}
+			}
+			runTrace = trace
+		}
+		if factories, err = withSimClock(factories, &wl, false); err != nil {
+			return nil, err
+		}
+		doc, err := rerun.runRepeated(factories, []Workload{wl}, runTrace)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range doc.Runs {
+			if capacity, ok := capacities[r.Name]; ok && r.Cache.Capacity != capacity {
+				return nil, fmt.Errorf("%s: capacity %d bytes, the baseline had %d", r.Name, r.Cache.Capacity, capacity)
+			}
+		}
+		cur.Runs = append(cur.Runs, doc.Runs...)
+		cur.Settings = doc.Settings
+	}
+	if cfg.Save != "" {
+		f, err := os.Create(cfg.Save)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := writeJSON(f, cur); err != nil {
+			return nil, err
+		}
+	}
+	return CompareDocuments(baseline, cur, cfg.Alpha, cfg.Threshold), nil
+}
+
+// report draws the inputs into a HTML page
+func (cfg *CLIConfig) report(stdout io.Writer) error {
+	if cfg.Inputs == "" {
+		return fmt.Errorf("report needs -inputs")
+	}
+	r, err := LoadReport(strings.Split(cfg.Inputs, ","))
+	if err != nil {
+		return err
+	}
+	if cfg.Out == "" {
+		return r.WriteHTML(stdout)
+	}
+	f, err := os.Create(cfg.Out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := r.WriteHTML(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeOutput writes the result document of the run and replay modes, or
+// the table of the other ones wrapped with the environment and wl in JSON.
+// Text prints the runs in full and the tables aligned in columns
+func writeOutput(w io.Writer, format string, t csvTable, wl *WorkloadParams) error {
+	doc, isDoc := t.(*ResultDocument)
+	switch {
+	case format == "benchstat" && isDoc:
+		return doc.WriteBenchstat(w)
+	case format == "benchstat":
+		return fmt.Errorf("benchstat output is only available for the run and replay modes")
+	case format == "text" && isDoc:
+		return doc.WriteText(w)
+	case format == "json" && !isDoc:
+		return writeJSON(w, NewTableDocument(t, wl))
+	case format != "text":
+		return WriteTable(w, format, t)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.csvHeader(), "\t"))
+	for _, row := range t.csvRows() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,119 @@
+package benchmark
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCLIFlagsOverrideConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"caches":"map","workload":"ycsb-b","goroutines":4,"duration":"3s"}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseCLI([]string{"-config", path, "-goroutines", "8", "-keys", "uniform"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Caches != "map" || cfg.Goroutines != 8 || time.Duration(cfg.Duration) != 3*time.Second {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	wl, err := cfg.BuildWorkload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wl.Name != "ycsb-b" || wl.Read != 95 || wl.Goroutines != 8 || wl.Keys != (UniformKeys{}) || !wl.Preload {
+		t.Fatalf("unexpected workload %s", wl.String())
+	}
+}
+
+func TestCapacityWorkload(t *testing.T) {
+	cfg, err := ParseCLI([]string{"-mode", "capacity", "-keys", "uniform", "-values", "small", "-mix", "90,10,0,0,0", "-records", "5000"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl, err := cfg.capacityWorkload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wl.Keys != (UniformKeys{}) || wl.Values == nil || wl.Read != 90 || wl.Write != 10 || wl.Records != 5000 || !wl.FillOnMiss {
+		t.Fatalf("unexpected workload %s", wl.String())
+	}
+	for _, args := range [][]string{{"-workload", "ycsb-a"}, {"-ttl", "fixed-30s", "-sim-tick", "1ms"}} {
+		cfg, err := ParseCLI(append([]string{"-mode", "capacity"}, args...), io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.capacityWorkload(); err == nil {
+			t.Errorf("%v accepted in capacity mode", args)
+		}
+	}
+}
+
+func TestSelectAdapters(t *testing.T) {
+	factories, err := SelectAdapters("heyicache,FreeCache", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(factories) != 2 || factories[0].Name != "HeyiCache" || factories[1].Name != "FreeCache" {
+		t.Fatalf("unexpected caches %v", factories)
+	}
+	// every cache under test takes the same budget
+	factories, err = SelectAdapters("all", 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(factories) != len(Adapters) {
+		t.Fatalf("%d of %d caches can be sized", len(factories), len(Adapters))
+	}
+	// heyicache isn't given more than the others below its minimum
+	if factories, err = SelectAdapters("all", 8); err != nil || len(factories) != len(Adapters)-1 {
+		t.Fatalf("%d caches at 8MB: %v", len(factories), err)
+	}
+	for _, f := range factories {
+		if f.Name == "HeyiCache" {
+			t.Fatal("heyicache picked at 8MB")
+		}
+	}
+	if _, err := SelectAdapters("map,heyicache", 8); err == nil {
+		t.Fatal("heyicache picked at 8MB")
+	}
+}
+
+func TestSelectAdaptersCodec(t *testing.T) {
+	factories, err := SelectAdapters("freecache/json,bigcache/binary+zlib", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(factories) != 2 || factories[0].Name != "FreeCache/json" || factories[1].Name != "BigCache/binary+zlib" {
+		t.Fatalf("unexpected caches %v", factories)
+	}
+	cache, err := factories[0].New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the name of a run selects the same cache again
+	if cache.Name() != factories[0].Name {
+		t.Fatalf("cache %s built by %s", cache.Name(), factories[0].Name)
+	}
+	if _, err := SelectAdapters("heyicache/json", 0); err == nil {
+		t.Fatal("heyicache doesn't encode its values")
+	}
+
+	codecs, err := ParseCodecs("binary,gob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range WithCodecs(Adapters, codecs) {
+		names = append(names, f.Name)
+	}
+	want := []string{"Map", "GoCache", "FreeCache", "FreeCache/gob", "BigCache", "BigCache/gob", "HeyiCache"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("got caches %v, want %v", names, want)
+	}
+}
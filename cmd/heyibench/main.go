@@ -0,0 +1,13 @@
+package main
+
+import (
+	"os"
+
+	benchmark "github.com/yuadsl3010/heyicache-benchmark"
+)
+
+// heyibench runs the benchmarks of this repository without a Go toolchain:
+// go build -o heyibench ./cmd/heyibench && ./heyibench -h
+func main() {
+	os.Exit(benchmark.RunCLI(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,367 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRegression is returned when a comparison finds a significant regression
+// past the threshold
+var ErrRegression = errors.New("performance regressed")
+
+// LoadResultDocument reads a result document written with -format json
+func LoadResultDocument(path string) (*ResultDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &ResultDocument{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(doc.Runs) == 0 {
+		return nil, fmt.Errorf("%s: no runs", path)
+	}
+	return doc, nil
+}
+
+// Workload rebuilds the workload the parameters were recorded from
+func (p WorkloadParams) Workload() (Workload, error) {
+	wl := Workload{
+		Name:          p.Name,
+		Read:          p.Read,
+		Write:         p.Write,
+		Delete:        p.Delete,
+		Verify:        p.Verify,
+		Peek:          p.Peek,
+		Records:       p.Records,
+		Goroutines:    p.Goroutines,
+		OpsPerRequest: p.OpsPerRequest,
+		Seed:          p.Seed,
+		Latency:       true,
+		Preload:       p.Preload,
+		FillOnMiss:    p.FillOnMiss,
+		AppLoad:       p.AppLoad,
+		ReadModify:    p.ReadModify,
+		Rate:          p.Rate,
+		BaselineLoop:  p.BaselineLoop,
+	}
+	keys, err := ParseKeyDistribution(p.Keys)
+	if err != nil {
+		return wl, err
+	}
+	wl.Keys = keys
+	if p.Rate > 0 {
+		if wl.Arrival, err = parseArrival(p.Arrival); err != nil {
+			return wl, err
+		}
+	}
+	if wl.Pool, err = ParsePoolMode(p.Pool); err != nil {
+		return wl, err
+	}
+	if wl.LeaseCheck, err = ParseLeaseCheck(p.LeaseCheck); err != nil {
+		return wl, err
+	}
+	if p.Values != "" {
+		if wl.Values = ValueProfiles[p.Values]; wl.Values == nil {
+			return wl, fmt.Errorf("unknown value profile %q", p.Values)
+		}
+	}
+	if p.TTL != "" {
+		ttl, err := ParseTTLDistribution(p.TTL)
+		if err != nil {
+			return wl, err
+		}
+		var tick time.Duration
+		if p.SimTick != "" {
+			if tick, err = time.ParseDuration(p.SimTick); err != nil {
+				return wl, fmt.Errorf("sim tick %q: %v", p.SimTick, err)
+			}
+		}
+		wl = wl.WithTTL(ttl, tick)
+	}
+	return wl, nil
+}
+
+// Sample summarizes the values of one metric over the repetitions of a run
+type Sample struct {
+	Values []float64 `json:"values"`
+	Mean   float64   `json:"mean"`
+	Stddev float64   `json:"stddev"`
+}
+
+func newSample(values []float64) Sample {
+	s := Sample{Values: values}
+	if len(values) == 0 {
+		return s
+	}
+	for _, v := range values {
+		s.Mean += v
+	}
+	s.Mean /= float64(len(values))
+	if len(values) > 1 {
+		for _, v := range values {
+			s.Stddev += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(s.Stddev / float64(len(values)-1))
+	}
+	return s
+}
+
+// Comparison is one metric of one run, old is the baseline
+type Comparison struct {
+	Name        string  `json:"name"`
+	Metric      string  `json:"metric"`
+	Old         Sample  `json:"old"`
+	New         Sample  `json:"new"`
+	Delta       float64 `json:"delta_pct"` // change of the mean, relative to the baseline
+	P           float64 `json:"p"`         // Mann-Whitney U test, two sided
+	Significant bool    `json:"significant"`
+	Regression  bool    `json:"regression"`
+}
+
+type Comparisons []Comparison
+
+func (comparisons Comparisons) csvHeader() []string {
+	return []string{"name", "metric", "old", "old_stddev", "new", "new_stddev", "delta_pct", "p", "n", "note"}
+}
+
+func (comparisons Comparisons) csvRows() [][]string {
+	rows := make([][]string, 0, len(comparisons))
+	for _, c := range comparisons {
+		note := ""
+		switch {
+		case c.Regression:
+			note = "REGRESSION"
+		case !c.Significant:
+			note = "~"
+		}
+		rows = append(rows, []string{
+			c.Name,
+			c.Metric,
+			strconv.FormatFloat(c.Old.Mean, 'g', 6, 64),
+			strconv.FormatFloat(c.Old.Stddev, 'g', 3, 64),
+			strconv.FormatFloat(c.New.Mean, 'g', 6, 64),
+			strconv.FormatFloat(c.New.Stddev, 'g', 3, 64),
+			formatFloat(c.Delta, 2),
+			formatFloat(c.P, 3),
+			fmt.Sprintf("%d+%d", len(c.Old.Values), len(c.New.Values)),
+			note,
+		})
+	}
+	return rows
+}
+
+// Regressions returns the comparisons that regressed
+func (comparisons Comparisons) Regressions() Comparisons {
+	var regressions Comparisons
+	for _, c := range comparisons {
+		if c.Regression {
+			regressions = append(regressions, c)
+		}
+	}
+	return regressions
+}
+
+// regressed reports whether a change of delta percent of metric is a
+// regression past threshold percent: less throughput or a higher p99
+func regressed(metric string, delta, threshold float64) bool {
+	switch {
+	case metric == "ops/s":
+		return delta < -threshold
+	case strings.HasSuffix(metric, "-p99-ns"):
+		return delta > threshold
+	}
+	return false
+}
+
+// CompareDocuments compares every metric of the runs found in both
+// documents. Repetitions of a run share its name, a difference is
+// significant when the U test gives p < alpha, and a significant throughput
+// drop or p99 rise of more than threshold percent is a regression
+func CompareDocuments(old, cur *ResultDocument, alpha, threshold float64) Comparisons {
+	oldValues, names := groupMetrics(old)
+	newValues, _ := groupMetrics(cur)
+	var comparisons Comparisons
+	for _, name := range names {
+		metrics := newValues[name]
+		if metrics == nil {
+			continue
+		}
+		for _, metric := range sortedKeys(oldValues[name]) {
+			values, ok := metrics[metric]
+			if !ok {
+				continue
+			}
+			c := Comparison{
+				Name:   name,
+				Metric: metric,
+				Old:    newSample(oldValues[name][metric]),
+				New:    newSample(values),
+			}
+			if c.Old.Mean != 0 {
+				c.Delta = (c.New.Mean - c.Old.Mean) / math.Abs(c.Old.Mean) * 100
+			}
+			c.P = mannWhitneyU(c.Old.Values, c.New.Values)
+			c.Significant = c.P < alpha
+			c.Regression = c.Significant && regressed(metric, c.Delta, threshold)
+			comparisons = append(comparisons, c)
+		}
+	}
+	return comparisons
+}
+
+// groupMetrics collects the values of every metric per run name, names are
+// in the order of their first run
+func groupMetrics(doc *ResultDocument) (map[string]map[string][]float64, []string) {
+	groups := map[string]map[string][]float64{}
+	var names []string
+	for _, run := range doc.Runs {
+		metrics := groups[run.Name]
+		if metrics == nil {
+			metrics = map[string][]float64{}
+			groups[run.Name] = metrics
+			names = append(names, run.Name)
+		}
+		for _, m := range run.Metrics {
+			metrics[m.Name] = append(metrics[m.Name], m.Value)
+		}
+	}
+	return groups, names
+}
+
+func sortedKeys(m map[string][]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mannWhitneyU returns the two sided p-value of the Mann-Whitney U test of
+// a and b, the test benchstat uses. Without ties and with small samples the
+// exact distribution of U is used, the normal approximation otherwise
+func mannWhitneyU(a, b []float64) float64 {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 1
+	}
+	type obs struct {
+		v     float64
+		fromA bool
+	}
+	all := make([]obs, 0, n+m)
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// rank sum of a with mid ranks for ties, tieTerm is the sum of t^3-t
+	// over the groups of t tied values
+	var rankA, tieTerm float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankA += rank
+			}
+		}
+		t := float64(j - i)
+		tieTerm += t*t*t - t
+		i = j
+	}
+	u := rankA - float64(n*(n+1))/2
+	total := float64(n + m)
+
+	if tieTerm == 0 && n*m <= 400 {
+		// count the arrangements with a U of at most u, and at least u
+		lower := uCount(n, m, int(u))
+		upper := uCount(n, m, n*m-int(u))
+		p := 2 * min(lower, upper) / binomial(n+m, n)
+		return min(p, 1)
+	}
+	mean := float64(n*m) / 2
+	variance := float64(n*m) / 12 * (total + 1 - tieTerm/(total*(total-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	return min(math.Erfc(max(z, 0)/math.Sqrt2), 1)
+}
+
+// minP is the smallest p-value the U test can give for n and m values, the
+// one of the two samples not overlapping at all
+func minP(n, m int) float64 {
+	if n == 0 || m == 0 {
+		return 1
+	}
+	return min(2/binomial(n+m, n), 1)
+}
+
+// minCount is the smallest number of repetitions on both sides that can give
+// a p-value below alpha
+func minCount(alpha float64) int {
+	n := 1
+	for minP(n, n) >= alpha {
+		n++
+	}
+	return n
+}
+
+// uCount is the number of orderings of n and m values whose U is at most u
+func uCount(n, m, u int) float64 {
+	if u < 0 {
+		return 0
+	}
+	// f[i][j][k]: orderings of i and j values with U == k
+	f := make([][][]float64, n+1)
+	for i := range f {
+		f[i] = make([][]float64, m+1)
+		for j := range f[i] {
+			f[i][j] = make([]float64, i*j+1)
+			switch {
+			case i == 0 || j == 0:
+				f[i][j][0] = 1
+			default:
+				for k := range f[i][j] {
+					// the largest value is from the first sample and beats
+					// the j others, or it is from the second one
+					if k >= j {
+						f[i][j][k] += f[i-1][j][k-j]
+					}
+					if k < len(f[i][j-1]) {
+						f[i][j][k] += f[i][j-1][k]
+					}
+				}
+			}
+		}
+	}
+	var count float64
+	for k := 0; k <= min(u, n*m); k++ {
+		count += f[n][m][k]
+	}
+	return count
+}
+
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
@@ -0,0 +1,134 @@
+package benchmark
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	for _, tc := range []struct {
+		a, b []float64
+		p    float64
+	}{
+		{[]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+		{[]float64{6, 7, 8, 9, 10}, []float64{1, 2, 3, 4, 5}, 2.0 / 252},
+		{[]float64{1, 3, 5}, []float64{2, 4, 6}, 0.7},
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1},
+		{[]float64{1}, nil, 1},
+	} {
+		if p := mannWhitneyU(tc.a, tc.b); math.Abs(p-tc.p) > 1e-9 {
+			t.Errorf("U test of %v and %v: p=%g, want %g", tc.a, tc.b, p, tc.p)
+		}
+	}
+}
+
+func TestCompareDocumentsFindsRegressions(t *testing.T) {
+	doc := func(throughput, p99 []float64) *ResultDocument {
+		d := &ResultDocument{}
+		for i := range throughput {
+			d.Runs = append(d.Runs, RunDocument{
+				Name:    "HeyiCache/default",
+				Metrics: []Metric{{"ops/s", throughput[i]}, {"get-hit-p99-ns", p99[i]}},
+			})
+		}
+		return d
+	}
+	old := doc([]float64{100, 101, 99, 100, 102}, []float64{500, 510, 490, 505, 495})
+	cur := doc([]float64{90, 91, 89, 90, 92}, []float64{501, 509, 489, 506, 494})
+	comparisons := CompareDocuments(old, cur, 0.05, 5)
+	if len(comparisons) != 2 {
+		t.Fatalf("got %d comparisons, want 2", len(comparisons))
+	}
+	regressions := comparisons.Regressions()
+	if len(regressions) != 1 || regressions[0].Metric != "ops/s" {
+		t.Fatalf("unexpected regressions %+v", regressions)
+	}
+	if math.Abs(regressions[0].Delta+9.9) > 0.1 {
+		t.Fatalf("unexpected delta %g", regressions[0].Delta)
+	}
+	if comparisons[0].Metric != "get-hit-p99-ns" || comparisons[0].Significant {
+		t.Fatalf("p99 didn't change: %+v", comparisons[0])
+	}
+}
+
+// TestCompareBaselineSettings checks compare reruns the baseline with its
+// duration and capacity, not the ones of its own flags
+func TestCompareBaselineSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	args := []string{"-caches", "map", "-capacity", "8", "-duration", "20ms", "-records", "1000", "-count", "4", "-format", "json", "-out", path}
+	if code := RunCLI(args, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("baseline run exited with %d", code)
+	}
+	cfg, err := ParseCLI([]string{"-mode", "compare", "-baseline", path, "-duration", "1h", "-count", "4"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := cfg.compare(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Fatalf("compare ran for %s", d)
+	}
+
+	// a baseline without settings can't tell the capacity, the rerun fails
+	// rather than comparing a bounded map to an unbounded one
+	baseline, err := LoadResultDocument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseline.Settings = RunSettings{Duration: 0.02}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(f, baseline); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := cfg.compare(); err == nil {
+		t.Fatal("a rerun with another capacity was compared")
+	}
+}
+
+// TestCompareCount checks compare refuses repetitions that can't give a
+// significant difference, and reruns the null cache once per workload
+func TestCompareCount(t *testing.T) {
+	if n := minCount(0.05); n != 4 || minP(3, 3) != 0.1 {
+		t.Fatalf("minCount(0.05) = %d, minP(3, 3) = %g", n, minP(3, 3))
+	}
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	args := []string{"-caches", "map,gocache", "-calibrate", "-duration", "10ms", "-records", "1000", "-count", "4", "-format", "json", "-out", path}
+	if code := RunCLI(args, io.Discard, io.Discard); code != 0 {
+		t.Fatalf("baseline run exited with %d", code)
+	}
+	cfg, err := ParseCLI([]string{"-mode", "compare", "-baseline", path}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.compare(); err == nil {
+		t.Fatal("a compare with one repetition was accepted")
+	}
+	save := filepath.Join(t.TempDir(), "rerun.json")
+	if cfg, err = ParseCLI([]string{"-mode", "compare", "-baseline", path, "-calibrate", "-count", "4", "-save", save}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.compare(); err != nil {
+		t.Fatal(err)
+	}
+	rerun, err := LoadResultDocument(save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := map[string]int{}
+	for _, run := range rerun.Runs {
+		runs[run.Cache.Name]++
+	}
+	if runs["Null"] != 1 || runs["Map"] != 4 || runs["GoCache"] != 4 {
+		t.Fatalf("unexpected reruns %v", runs)
+	}
+}
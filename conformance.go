@@ -0,0 +1,419 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Conformance is the correctness suite every cache under test can be run
+// through. A check needing a capability the cache lacks (TTLSetter, Deleter,
+// EntryLimiter, EvictionCounter or EvacuationCounter) is skipped, not failed
+type Conformance struct {
+	Factory AdapterFactory
+	// Sized builds a small instance for the eviction check, nil skips it
+	Sized *SizedAdapterFactory
+	// Known reports the mismatches the cache is known to have, they're
+	// logged instead of failing the checks, see KnownMismatches
+	Known func(Mismatch) bool
+
+	logged *sync.Map // paths of the known mismatches already logged
+}
+
+// KnownMismatches are the bugs the caches under test are known to have, by
+// cache name
+var KnownMismatches = map[string]func(Mismatch) bool{
+	// heyicache copies the structs it embeds by value with their string
+	// headers: their skip-tagged strings aren't zero, they point into the
+	// value that was set and dangle once it's freed
+	"HeyiCache": func(m Mismatch) bool { return strings.HasSuffix(m.Path, ".TestSkip") },
+}
+
+const (
+	// conformanceTTL is the ttl of the expiry check, caches count in seconds
+	conformanceTTL = time.Second
+	// conformanceCapacity is the budget of the eviction check
+	conformanceCapacity = 4 << 20
+)
+
+// Run runs every check on a fresh cache
+func (c Conformance) Run(t *testing.T) {
+	c.logged = &sync.Map{}
+	checks := []struct {
+		name  string
+		check func(t *testing.T, cache CacheAdapter)
+	}{
+		{"RoundTrip", c.roundTrip},
+		{"Miss", c.miss},
+		{"Overwrite", c.overwrite},
+		{"Delete", c.delete},
+		{"TTL", c.ttl},
+		{"LargeValue", c.largeValue},
+		{"LargeKey", c.largeKey},
+		{"ConcurrentWriters", c.concurrentWriters},
+	}
+	for _, check := range checks {
+		t.Run(check.name, func(t *testing.T) {
+			cache, err := c.Factory.New()
+			if err != nil {
+				t.Fatalf("create %s: %v", c.Factory.Name, err)
+			}
+			defer closeCache(cache)
+			check.check(t, cache)
+		})
+	}
+	t.Run("Eviction", c.eviction)
+}
+
+// mismatches returns the differences between the value of key and want but
+// the known ones, which are logged once per path. ok is false when key misses
+func (c Conformance) mismatches(t *testing.T, cache CacheAdapter, key string, want *TestStruct) (mismatches []Mismatch, ok bool) {
+	t.Helper()
+	scope := beginScope(cache)
+	defer scope.Done()
+	got, ok := scope.Get(key)
+	if !ok {
+		return nil, false
+	}
+	mismatches, known := c.unknown(VerifyTestStruct(got, want, VerifyModeOf(cache)))
+	for _, m := range known {
+		if _, seen := c.logged.LoadOrStore(m.Path, true); !seen {
+			t.Logf("known failure: %s: %s", shortKey(key), m)
+		}
+	}
+	return mismatches, true
+}
+
+// unknown splits the known mismatches off
+func (c Conformance) unknown(mismatches []Mismatch) (unknown, known []Mismatch) {
+	if c.Known == nil {
+		return mismatches, nil
+	}
+	for _, m := range mismatches {
+		if c.Known(m) {
+			known = append(known, m)
+		} else {
+			unknown = append(unknown, m)
+		}
+	}
+	return unknown, known
+}
+
+// expect fails unless key holds want
+func (c Conformance) expect(t *testing.T, cache CacheAdapter, key string, want *TestStruct) {
+	t.Helper()
+	mismatches, ok := c.mismatches(t, cache, key, want)
+	if !ok {
+		t.Fatalf("%s: miss", shortKey(key))
+	}
+	if len(mismatches) > 0 {
+		t.Fatalf("%s: %v", shortKey(key), mismatches)
+	}
+}
+
+// expectMiss fails unless key misses
+func expectMiss(t *testing.T, cache CacheAdapter, key string) {
+	t.Helper()
+	scope := beginScope(cache)
+	defer scope.Done()
+	if _, ok := scope.Get(key); ok {
+		t.Fatalf("%s: hit, want a miss", shortKey(key))
+	}
+}
+
+// shortKey cuts the large keys in messages
+func shortKey(key string) string {
+	if len(key) <= 64 {
+		return key
+	}
+	return fmt.Sprintf("%s... (%d bytes)", key[:64], len(key))
+}
+
+func (c Conformance) roundTrip(t *testing.T, cache CacheAdapter) {
+	for id := 0; id < 100; id++ {
+		k, v := NewTestStruct(id)
+		if err := cache.Set(k, v); err != nil {
+			t.Fatalf("set %s: %v", k, err)
+		}
+	}
+	for id := 0; id < 100; id++ {
+		k, v := NewTestStruct(id)
+		c.expect(t, cache, k, v)
+	}
+}
+
+func (c Conformance) miss(t *testing.T, cache CacheAdapter) {
+	expectMiss(t, cache, GetKey(0))
+	k, v := NewTestStruct(1)
+	if err := cache.Set(k, v); err != nil {
+		t.Fatal(err)
+	}
+	expectMiss(t, cache, GetKey(0))
+	expectMiss(t, cache, "")
+}
+
+func (c Conformance) overwrite(t *testing.T, cache CacheAdapter) {
+	k, v1 := NewTestStruct(1)
+	_, v2 := NewTestStruct(2)
+	if err := cache.Set(k, v1); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Set(k, v2); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, cache, k, v2)
+}
+
+func (c Conformance) delete(t *testing.T, cache CacheAdapter) {
+	d, ok := cache.(Deleter)
+	if !ok {
+		t.Skip("no Deleter")
+	}
+	k, v := NewTestStruct(3)
+	if d.Del(k) {
+		t.Fatalf("deleted %s before it was set", k)
+	}
+	if err := cache.Set(k, v); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Del(k) {
+		t.Fatalf("%s not deleted", k)
+	}
+	expectMiss(t, cache, k)
+	if d.Del(k) {
+		t.Fatalf("%s deleted twice", k)
+	}
+	// a deleted key can be set again
+	if err := cache.Set(k, v); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, cache, k, v)
+}
+
+func (c Conformance) ttl(t *testing.T, cache CacheAdapter) {
+	setter, ok := cache.(TTLSetter)
+	if !ok {
+		t.Skip("no TTLSetter")
+	}
+	expiring, v := NewTestStruct(4)
+	forever, w := NewTestStruct(5)
+	if err := setter.SetWithTTL(expiring, v, conformanceTTL); err != nil {
+		t.Fatal(err)
+	}
+	if err := setter.SetWithTTL(forever, w, 0); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, cache, expiring, v)
+	// whole seconds round up, give the clock of the cache one more
+	deadline := time.Now().Add(conformanceTTL + 2*time.Second)
+	for {
+		scope := beginScope(cache)
+		_, ok := scope.Get(expiring)
+		scope.Done()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s still there %s after its ttl", expiring, conformanceTTL+2*time.Second)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	c.expect(t, cache, forever, w)
+}
+
+// largeValue writes a value over the entry limit of the cache: it must be
+// refused, not stored cut
+func (c Conformance) largeValue(t *testing.T, cache CacheAdapter) {
+	limiter, ok := cache.(EntryLimiter)
+	if !ok {
+		t.Skip("no EntryLimiter")
+	}
+	k, v := NewTestStruct(6)
+	// random bytes don't compress, and every codec stores the protobuf field
+	v.TestProto.TestBytes = make([]byte, limiter.MaxEntryBytes()+1)
+	_, _ = rand.NewChaCha8([32]byte{6}).Read(v.TestProto.TestBytes)
+	if err := cache.Set(k, v); err == nil {
+		t.Fatalf("a %d bytes value over the %d bytes limit was accepted", len(v.TestProto.TestBytes), limiter.MaxEntryBytes())
+	}
+	expectMiss(t, cache, k)
+	// the cache still works
+	_, small := NewTestStruct(7)
+	if err := cache.Set(k, small); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(t, cache, k, small)
+}
+
+// largeKey writes keys up to 1MB: every cache may refuse them, a key it
+// accepts must come back whole
+func (c Conformance) largeKey(t *testing.T, cache CacheAdapter) {
+	_, v := NewTestStruct(8)
+	for _, n := range []int{1 << 10, 1<<16 + 1, 1 << 20} {
+		k := strings.Repeat("k", n)
+		if err := cache.Set(k, v); err != nil {
+			t.Logf("%d bytes key refused: %v", n, err)
+			expectMiss(t, cache, k)
+			continue
+		}
+		c.expect(t, cache, k, v)
+		// a key sharing a prefix is another key
+		expectMiss(t, cache, k[:n-1])
+	}
+}
+
+// concurrentWriters sets one key from several goroutines while others read
+// it: every read misses or returns one of the values written, whole. A cache
+// may refuse writes under the burst, once it's over it takes them again
+func (c Conformance) concurrentWriters(t *testing.T, cache CacheAdapter) {
+	const (
+		writers = 8
+		sets    = 200
+		readers = 2
+	)
+	key := "conformance-shared"
+	values := make([]*TestStruct, writers)
+	for i := range values {
+		_, values[i] = NewTestStruct(100 + i)
+	}
+	done := make(chan struct{})
+	errs := make(chan string, readers)
+	var failed atomic.Int64
+	wg := &sync.WaitGroup{}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if found, m := c.readWritten(cache, key, values); found && len(m) > 0 {
+					errs <- fmt.Sprintf("read a value that was never written: %v", m)
+					return
+				}
+			}
+		}()
+	}
+	writersWg := &sync.WaitGroup{}
+	for w := 0; w < writers; w++ {
+		writersWg.Add(1)
+		go func(w int) {
+			defer writersWg.Done()
+			for i := 0; i < sets; i++ {
+				if cache.Set(key, values[w]) != nil {
+					failed.Add(1)
+				}
+			}
+		}(w)
+	}
+	writersWg.Wait()
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := failed.Load(); n > 0 {
+		t.Logf("%d of %d writes refused", n, writers*sets)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for cache.Set(key, values[0]) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("writes still refused a second after the burst")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.expect(t, cache, key, values[0])
+}
+
+// readWritten reads key in one scope and reports whether it was found and
+// when it doesn't hold any of values, the mismatches with the first one
+func (c Conformance) readWritten(cache CacheAdapter, key string, values []*TestStruct) (bool, []Mismatch) {
+	scope := beginScope(cache)
+	defer scope.Done()
+	got, ok := scope.Get(key)
+	if !ok {
+		return false, nil
+	}
+	var first []Mismatch
+	for _, want := range values {
+		mismatches, _ := c.unknown(VerifyTestStruct(got, want, VerifyModeOf(cache)))
+		if len(mismatches) == 0 {
+			return true, nil
+		}
+		if first == nil {
+			first = mismatches
+		}
+	}
+	return true, first
+}
+
+// eviction fills a small cache past its capacity: it keeps taking writes,
+// the oldest entries miss, the newest hit, and no key returns another value
+func (c Conformance) eviction(t *testing.T) {
+	if c.Sized == nil {
+		t.Skip("no sized factory")
+	}
+	cache, err := c.Sized.New(conformanceCapacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCache(cache)
+	evictions, ok := evictionCount(cache)
+	if !ok {
+		t.Skip("no EvictionCounter")
+	}
+	// write until the first eviction, then as much again
+	const maxRecords = 1 << 20
+	n := 0
+	for ; n < maxRecords && evictions() == 0; n++ {
+		k, v := NewTestStruct(n)
+		if err := cache.Set(k, v); err != nil {
+			t.Fatalf("set %s: %v", k, err)
+		}
+	}
+	if evictions() == 0 {
+		t.Fatalf("no eviction after %d records", n)
+	}
+	for end := 2 * n; n < end; n++ {
+		k, v := NewTestStruct(n)
+		if err := cache.Set(k, v); err != nil {
+			t.Fatalf("set %s after evicting: %v", k, err)
+		}
+	}
+	hits := 0
+	for id := 0; id < n; id++ {
+		k, v := NewTestStruct(id)
+		mismatches, ok := c.mismatches(t, cache, k, v)
+		if !ok {
+			continue
+		}
+		hits++
+		if len(mismatches) > 0 {
+			t.Fatalf("%s after %d evictions: %v", k, evictions(), mismatches)
+		}
+	}
+	expectMiss(t, cache, GetKey(0))
+	k, v := NewTestStruct(n - 1)
+	c.expect(t, cache, k, v)
+	t.Logf("%d records, %d evictions, %d hits", n, evictions(), hits)
+}
+
+// evictionCount returns the count of the entries cache dropped to make room,
+// of the ones it dropped or moved when it only counts evacuations
+func evictionCount(cache CacheAdapter) (func() int64, bool) {
+	switch c := cache.(type) {
+	case EvictionCounter:
+		return c.Evictions, true
+	case EvacuationCounter:
+		return c.Evacuations, true
+	}
+	return nil, false
+}
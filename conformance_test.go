@@ -0,0 +1,26 @@
+package benchmark
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestConformance runs the conformance suite on every cache under test and
+// on the byte caches with every codec
+func TestConformance(t *testing.T) {
+	codecs, err := ParseCodecs("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, factory := range WithCodecs(Adapters, codecs) {
+		// the codec variants are checked for evictions on the cache they wrap
+		name, _, _ := strings.Cut(factory.Name, "/")
+		c := Conformance{Factory: factory, Known: KnownMismatches[name]}
+		for i := range SizedAdapters {
+			if SizedAdapters[i].Name == name {
+				c.Sized = &SizedAdapters[i]
+			}
+		}
+		t.Run(factory.Name, c.Run)
+	}
+}
@@ -1,18 +1,29 @@
-package main
+package benchmark
 
 import (
+	"flag"
 	"fmt"
 	"testing"
 	"time"
 	"unsafe"
 )
 
+var (
+	sweepOut      = flag.String("sweep.out", "", "run the concurrency sweep and write it to this .json or .csv file")
+	sweepFactor   = flag.Int("sweep.factor", 4, "the sweep goes up to sweep.factor*GOMAXPROCS goroutines")
+	sweepDuration = flag.Duration("sweep.duration", 2*time.Second, "duration of every step of the sweeps")
+	capacityOut   = flag.String("capacity.out", "", "run the capacity sweep and write it to this .json or .csv file")
+	memoryOut     = flag.String("memory.out", "", "run the memory per entry measurement and write it to this .json or .csv file")
+	memoryEntries = flag.Int("memory.entries", 50000, "entries written by the memory per entry measurement")
+	tracePath     = flag.String("replay", "", "replay this trace against every cache")
+	traceFormat   = flag.String("replay.format", "", "format of -replay: jsonl, binary, twitter or oracle-general, guessed from the extension when empty")
+	traceSpeed    = flag.Float64("replay.speed", 0, "replay speed relative to the recorded time, 0 replays as fast as possible")
+)
+
 func BenchmarkMap(b *testing.B) {
 	// return
 	// init data
-	ifc := &TestMap{
-		c: make(map[string]*TestStruct, maxNum),
-	}
+	ifc := NewTestMap(maxNum)
 
 	// run benchmark
 	BenchIfc(b, ifc)
@@ -28,7 +39,7 @@ func BenchmarkFreeCache(b *testing.B) {
 	// return
 	// 设置缓存大小为100MB
 	cache := NewTestFreeCache(100 * 1024 * 1024)
-	BenchIfcForFreeCacheAndBigCache(b, cache)
+	BenchIfc(b, cache)
 }
 
 func BenchmarkBigCache(b *testing.B) {
@@ -38,13 +49,13 @@ func BenchmarkBigCache(b *testing.B) {
 	if err != nil {
 		b.Fatalf("Failed to create BigCache: %v", err)
 	}
-	BenchIfcForFreeCacheAndBigCache(b, cache)
+	BenchIfc(b, cache)
 }
 
 func BenchmarkHeyiCache(b *testing.B) {
 	// 设置缓存大小为100MB
 	cache := NewTestHeyiCache(100)
-	BenchHeyiCache(b, cache)
+	BenchIfc(b, cache)
 
 	// evictionNum := cache.Cache.EvictionNum()             // 淘汰个数
 	// evictionCount := cache.Cache.EvictionCount()         // 淘汰触发次数
@@ -75,6 +86,159 @@ func BenchmarkHeyiCache(b *testing.B) {
 	// fmt.Printf("entryCount: %d\n", entryCount)
 }
 
+// BenchmarkNull runs the baseline loop against the cache that stores nothing,
+// it's the cost of the harness alone
+func BenchmarkNull(b *testing.B) {
+	BenchIfc(b, NewTestNullCache())
+}
+
+// BenchmarkCalibrated runs the default workload against every cache and
+// reports it with the cost of the harness, measured with the null cache,
+// subtracted in net-ns/op and net-ops/s
+func BenchmarkCalibrated(b *testing.B) {
+	eachAdapter(b, Adapters, func(b *testing.B, cache CacheAdapter) {
+		BenchCalibrated(b, cache, DefaultWorkload)
+	})
+}
+
+// benchAdapters runs wl against a fresh instance of every cache, one sub
+// benchmark per cache
+func benchAdapters(b *testing.B, factories []AdapterFactory, wl Workload) {
+	eachAdapter(b, factories, func(b *testing.B, cache CacheAdapter) {
+		BenchWorkload(b, cache, wl)
+	})
+}
+
+// eachAdapter runs bench against a fresh instance of every cache, one sub
+// benchmark per cache
+func eachAdapter(b *testing.B, factories []AdapterFactory, bench func(b *testing.B, cache CacheAdapter)) {
+	for _, factory := range factories {
+		b.Run(factory.Name, func(b *testing.B) {
+			cache, err := factory.New()
+			if err != nil {
+				b.Fatalf("Failed to create %s: %v", factory.Name, err)
+			}
+			bench(b, cache)
+		})
+	}
+}
+
+// BenchmarkWorkloads runs every YCSB preset against every cache
+func BenchmarkWorkloads(b *testing.B) {
+	for _, name := range PresetNames() {
+		wl := WorkloadPresets[name]
+		b.Run(name, func(b *testing.B) {
+			benchAdapters(b, Adapters, wl)
+		})
+	}
+}
+
+// BenchmarkKeyDistributions runs the default mix under every key distribution
+func BenchmarkKeyDistributions(b *testing.B) {
+	for _, keys := range KeyDistributions {
+		wl := DefaultWorkload.WithKeys(keys)
+		b.Run(keys.Name(), func(b *testing.B) {
+			benchAdapters(b, Adapters, wl)
+		})
+	}
+}
+
+// BenchmarkOpenLoop offers every cache the same fixed rate, a cache that can't
+// keep up shows it in its latency instead of simply getting fewer requests
+func BenchmarkOpenLoop(b *testing.B) {
+	for _, arrival := range []Arrival{ArrivalConstant, ArrivalPoisson} {
+		wl := DefaultWorkload.WithRate(200000, arrival)
+		b.Run(arrival.String(), func(b *testing.B) {
+			benchAdapters(b, Adapters, wl)
+		})
+	}
+}
+
+// TestConcurrencySweep measures how every cache scales with goroutines:
+// go test -run TestConcurrencySweep -sweep.out sweep.csv
+func TestConcurrencySweep(t *testing.T) {
+	if *sweepOut == "" {
+		t.Skip("set -sweep.out to run the concurrency sweep")
+	}
+	points, err := ConcurrencySweep(Adapters, DefaultWorkload, SweepSteps(*sweepFactor), *sweepDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTable(*sweepOut, points); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestCapacitySweep records the miss ratio curve of every bounded cache:
+// go test -run TestCapacitySweep -capacity.out capacity.csv
+func TestCapacitySweep(t *testing.T) {
+	if *capacityOut == "" {
+		t.Skip("set -capacity.out to run the capacity sweep")
+	}
+	points, err := CapacitySweep(SizedAdapters, CapacityWorkload, CapacityPercents, *sweepDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTable(*capacityOut, points); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkGC compares the GC cost of every cache holding 100k records, with
+// an allocating application goroutine running next to it
+func BenchmarkGC(b *testing.B) {
+	wl := DefaultWorkload
+	wl.Name = "gc"
+	wl.Records = 100000
+	wl.AppLoad = true
+	benchAdapters(b, Adapters, wl)
+}
+
+// TestMemoryPerEntry reports the bytes every cache spends per entry:
+// go test -run TestMemoryPerEntry -memory.out memory.csv
+func TestMemoryPerEntry(t *testing.T) {
+	if *memoryOut == "" {
+		t.Skip("set -memory.out to run the memory per entry measurement")
+	}
+	reports, err := MeasureMemoryAll(Adapters, *memoryEntries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range reports {
+		t.Log(reports[i].String())
+	}
+	if err := SaveTable(*memoryOut, reports); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReplay replays a recorded trace against every cache:
+// go test -run TestReplay -replay twitter.csv -replay.speed 10
+func TestReplay(t *testing.T) {
+	if *tracePath == "" {
+		t.Skip("set -replay to replay a trace")
+	}
+	trace, err := LoadTrace(*tracePath, *traceFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl := DefaultWorkload
+	wl.Name = "replay"
+	wl.FillOnMiss = true
+	for _, factory := range Adapters {
+		cache, err := factory.New()
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", factory.Name, err)
+		}
+		result, err := ReplayTrace(cache, &wl, trace, *traceSpeed)
+		closeCache(cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %d records, %d keys%s", factory.Name, len(trace.Records), trace.Keys, result)
+	}
+}
+
 func PrintString(testNamePtr *string) {
 	fmt.Printf("str: %s\n", *testNamePtr)
 	fmt.Printf("&str address: %p\n", testNamePtr)
@@ -111,5 +275,56 @@ func PrintString(testNamePtr *string) {
 
 // 	dst := r.(*TestStruct)
 // 	fmt.Println("dst", dst)
-// 	fmt.Println("diff", CheckTestStruct(id, dst, false))
+// 	fmt.Println("diff", VerifyTestStruct(dst, src, VerifyFlat))
 // }
+
+// BenchmarkValueProfiles runs the default mix with every value profile, the
+// entries a cache refuses as too large show up in over-limit% and write-fail%
+func BenchmarkValueProfiles(b *testing.B) {
+	for _, name := range ValueProfileNames() {
+		wl := DefaultWorkload
+		if name != "default" {
+			wl = wl.WithValues(ValueProfiles[name])
+		}
+		flat, _ := ValueSizes(wl.Values, wl.Records)
+		b.Run(name, func(b *testing.B) {
+			eachAdapter(b, Adapters, func(b *testing.B, cache CacheAdapter) {
+				over := OverLimitPercent(cache, &wl)
+				BenchWorkload(b, cache, wl)
+				// after the run, resetting the timer drops the metrics
+				b.ReportMetric(float64(flat.Quantile(0.5)), "value-p50-B")
+				b.ReportMetric(float64(flat.Quantile(0.99)), "value-p99-B")
+				b.ReportMetric(float64(flat.Max()), "value-max-B")
+				b.ReportMetric(over, "over-limit%")
+			})
+		})
+	}
+}
+
+// BenchmarkValuePool runs the default mix building the keys and values in the
+// measured loop, then from a pool: the difference of the two is what the
+// original benchmark spent outside of the cache, harness-ns/op estimates it
+func BenchmarkValuePool(b *testing.B) {
+	for _, mode := range []PoolMode{PoolOff, PoolPregenerate, PoolMemoize} {
+		wl := DefaultWorkload.WithPool(mode)
+		b.Run(mode.String(), func(b *testing.B) {
+			benchAdapters(b, Adapters, wl)
+		})
+	}
+}
+
+// BenchmarkCodecs runs the default mix on every byte cache with every codec,
+// heyicache, which doesn't decode, is the reference
+func BenchmarkCodecs(b *testing.B) {
+	codecs, err := ParseCodecs("all")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var factories []AdapterFactory
+	for _, factory := range WithCodecs(Adapters, codecs) {
+		if factory.Name != "Map" && factory.Name != "GoCache" {
+			factories = append(factories, factory)
+		}
+	}
+	benchAdapters(b, factories, DefaultWorkload)
+}
@@ -0,0 +1,352 @@
+package benchmark
+
+import (
+	"sync"
+	"time"
+)
+
+// RunWorkload drives ifc with wl.Goroutines goroutines, each of them running n
+// requests of wl.OpsPerRequest operations sampled from the mix of wl, or
+// following the baseline loop. A
+// request is one request scope, so leased caches release their values at the
+// end of every request
+func RunWorkload(ifc CacheAdapter, wl *Workload, n int) *BenchResult {
+	return runWorkload(ifc, wl, n, 0)
+}
+
+// RunWorkloadFor is RunWorkload running for d instead of a fixed number of
+// requests
+func RunWorkloadFor(ifc CacheAdapter, wl *Workload, d time.Duration) *BenchResult {
+	return runWorkload(ifc, wl, -1, d)
+}
+
+// runWorkload stops after n requests per goroutine when n >= 0, otherwise
+// after d, the deadline is checked once per request
+func runWorkload(ifc CacheAdapter, wl *Workload, n int, d time.Duration) *BenchResult {
+	sampler := newOpSampler(wl)
+	gens := wl.Keys.NewGenerators(wl.Records, wl.Goroutines)
+	return runGoroutines(ifc, wl, func(gIdx int, w *worker, start time.Time) {
+		deadline := start.Add(d)
+		r := newRand(wl.Seed, gIdx)
+		gen := gens[gIdx]
+		inserter, _ := gen.(keyInserter)
+		var p *pacer
+		if wl.Rate > 0 {
+			p = newPacer(wl, r, gIdx, start)
+		}
+		// the simulated clock moves one request at a time
+		tick := time.Duration(wl.OpsPerRequest) * wl.SimTick
+		for i := 0; n < 0 || i < n; i++ {
+			if n < 0 && time.Now().After(deadline) {
+				break
+			}
+			if wl.Clock != nil {
+				wl.Clock.Advance(tick)
+			}
+			var record int
+			if wl.BaselineLoop {
+				record = gen.Next(r)
+			}
+			scope := beginScope(ifc)
+			for j := 0; j < wl.OpsPerRequest; j++ {
+				if p != nil {
+					w.delay = p.wait()
+				}
+				if wl.BaselineLoop {
+					w.do(scope, baselineOp(j, wl.OpsPerRequest), record)
+					continue
+				}
+				op := sampler.next(r)
+				var id int
+				if op == OpWrite && inserter != nil {
+					id = inserter.NextInsert()
+				} else {
+					id = gen.Next(r)
+				}
+				w.do(scope, op, id)
+			}
+			w.done(scope)
+		}
+	})
+}
+
+// runGoroutines runs body on wl.Goroutines goroutines, each of them with its
+// own worker, and merges their results. It also takes the GC samples, runs
+// the application goroutine and counts the expirations around the run
+func runGoroutines(ifc CacheAdapter, wl *Workload, body func(gIdx int, w *worker, start time.Time)) *BenchResult {
+	// every goroutine counts into its own shard, merged after wg.Wait()
+	shards := make([]BenchResult, wl.Goroutines)
+	wg := &sync.WaitGroup{}
+	wg.Add(wl.Goroutines)
+	wl.Prepare()
+	pool := wl.valuePool()
+	var builtBefore int64
+	if pool != nil {
+		builtBefore = pool.Builds()
+	}
+	gcBefore := readGCSample()
+	cpuBefore := processCPU()
+	var app *appLoad
+	if wl.AppLoad {
+		app = startAppLoad()
+	}
+	if wl.LeaseCheck == LeaseCheckAfter {
+		stop := startPressure(ifc, wl)
+		defer stop()
+	}
+	expiry := newExpiryTracker(wl)
+	expirations, _ := ifc.(ExpirationCounter)
+	var expiredBefore int64
+	if expirations != nil {
+		expiredBefore = expirations.Expirations()
+	}
+	var simStart time.Duration
+	if wl.Clock != nil {
+		simStart = wl.Clock.Elapsed()
+	}
+	start := time.Now()
+	for g := 0; g < wl.Goroutines; g++ {
+		go func(gIdx int) {
+			defer wg.Done()
+			w := newWorker(ifc, wl)
+			w.expiry = expiry
+			defer func() { shards[gIdx] = w.result }()
+			body(gIdx, w, start)
+			if w.lease != nil {
+				w.lease.flush(&w.result)
+			}
+		}(g)
+	}
+	wg.Wait()
+	result := mergeResults(shards)
+	result.Elapsed = time.Since(start)
+	if cpuBefore > 0 {
+		result.CPU = processCPU() - cpuBefore
+	}
+	result.TargetRate = wl.Rate
+	var builds int64
+	if pool != nil {
+		builds = pool.Builds() - builtBefore
+	}
+	result.Harness = wl.prep.cost.perOp(result, builds)
+	if app != nil {
+		result.App = app.Stop(result.Elapsed)
+	}
+	gcAfter := readGCSample()
+	result.GC = gcDelta(gcBefore, gcAfter)
+	if expiry != nil && expirations != nil {
+		result.Expired = uint64(max(expirations.Expirations()-expiredBefore, 0))
+	}
+	if wl.Clock != nil {
+		result.SimElapsed = wl.Clock.Elapsed() - simStart
+	}
+	return result
+}
+
+// worker runs the operations of one goroutine and owns its result shard
+type worker struct {
+	ifc        CacheAdapter
+	deleter    Deleter
+	ttlSetter  TTLSetter
+	verifyMode VerifyMode
+	fillOnMiss bool
+	wl         *Workload
+	result     BenchResult
+	lat        *LatencySet
+	lease      *leaseChecker  // nil when the workload doesn't check leases
+	expiry     *expiryTracker // nil when the workload doesn't expire its records
+	delay      time.Duration  // how late the current operation started in open loop mode
+	replaying  *TraceRecord   // the trace record being replayed, its size and ttl apply to the writes it makes
+}
+
+func newWorker(ifc CacheAdapter, wl *Workload) *worker {
+	w := &worker{
+		ifc:        ifc,
+		verifyMode: VerifyModeOf(ifc),
+		fillOnMiss: wl.FillOnMiss,
+		wl:         wl,
+		lease:      newLeaseChecker(wl.LeaseCheck),
+	}
+	w.deleter, _ = ifc.(Deleter)
+	w.ttlSetter, _ = ifc.(TTLSetter)
+	if wl.Latency {
+		w.lat = &LatencySet{}
+		w.result.Latency = w.lat
+	}
+	return w
+}
+
+// now skips the clock read when latency isn't recorded
+func (w *worker) now() time.Time {
+	if w.lat == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (w *worker) observe(op LatencyOp, start time.Time) {
+	if w.lat != nil {
+		w.lat[op].Record(int64(time.Since(start) + w.delay))
+	}
+}
+
+// observeGet records a read as a hit or a miss
+func (w *worker) observeGet(ok bool, start time.Time) {
+	if ok {
+		w.result.ReadSuccess++
+		w.observe(LatGetHit, start)
+	} else {
+		w.result.ReadMiss++
+		w.observe(LatGetMiss, start)
+	}
+}
+
+func (w *worker) do(scope RequestScope, op Op, id int) {
+	defer func() { w.delay = 0 }()
+	if w.lease != nil {
+		// the values read by the earlier operations of the scope
+		defer w.lease.afterOp(&w.result, len(w.lease.held))
+	}
+	switch op {
+	case OpWrite:
+		if w.wl.ReadModify {
+			if v, ok := w.read(scope, id, false); ok {
+				w.held(v)
+			}
+			// the write only waited for the read
+			w.delay = 0
+		}
+		w.set(id)
+	case OpDelete:
+		key := w.wl.Key(id)
+		start := w.now()
+		ok := w.deleter.Del(key)
+		w.observe(LatDel, start)
+		if ok {
+			w.result.DelSuccess++
+		} else {
+			w.result.DelMiss++
+		}
+	case OpVerify:
+		v, ok := w.read(scope, id, false)
+		if !ok {
+			break
+		}
+		w.held(v)
+		_, right := w.wl.NewTestStruct(id)
+		if mismatches := VerifyTestStruct(v, right, w.verifyMode); len(mismatches) == 0 {
+			w.result.CheckSuccess++
+		} else {
+			w.result.CheckFail++
+			w.result.addMismatches(mismatches)
+		}
+	case OpPeek:
+		v, ok := w.read(scope, id, true)
+		if ok {
+			w.held(v)
+		}
+	default: // OpRead
+		v, ok := w.read(scope, id, false)
+		if ok {
+			w.held(v)
+		}
+		if !ok && w.fillOnMiss {
+			// the write is a new operation, it didn't queue
+			w.delay = 0
+			w.set(id)
+		}
+	}
+}
+
+// read gets record id through scope, without touching it when peeking. A
+// hit on an entry past its expiry is counted stale, unless the expiry changed
+// during the read: a write may have replaced the entry meanwhile
+func (w *worker) read(scope RequestScope, id int, peeking bool) (*TestStruct, bool) {
+	key := w.wl.Key(id)
+	var expireAt, now uint32
+	if w.expiry != nil {
+		expireAt = w.expiry.expiry(id)
+		now = w.expiry.now()
+	}
+	start := w.now()
+	var v *TestStruct
+	var ok bool
+	if peeking {
+		v, ok = peek(scope, key)
+	} else {
+		v, ok = scope.Get(key)
+	}
+	w.observeGet(ok, start)
+	if ok && w.expiry != nil {
+		w.result.TTLChecked++
+		if expireAt != 0 && expireAt <= now && w.expiry.expiry(id) == expireAt {
+			w.result.TTLStale++
+		}
+	}
+	return v, ok
+}
+
+// set writes record id with its ttl, the recorded one when replaying
+func (w *worker) set(id int) {
+	ttl := w.wl.ttl(id)
+	if w.replaying != nil {
+		ttl = w.replaying.TTL
+	}
+	w.write(id, ttl)
+}
+
+// write sets record id, with an expiration when ttl > 0 and the cache
+// supports it
+func (w *worker) write(id int, ttl time.Duration) {
+	k, v := w.value(id)
+	if w.expiry != nil {
+		w.expiry.writing(id)
+	}
+	start := w.now()
+	var err error
+	if ttl > 0 && w.ttlSetter != nil {
+		err = w.ttlSetter.SetWithTTL(k, v, ttl)
+	} else {
+		ttl = 0
+		err = w.ifc.Set(k, v)
+	}
+	w.observe(LatSet, start)
+	if err != nil {
+		w.result.WriteFail++
+	} else {
+		w.result.WriteSuccess++
+		if w.expiry != nil {
+			w.expiry.written(id, ttl)
+		}
+	}
+}
+
+// value builds the value of record id, at the size of the trace record being
+// replayed when it has one
+func (w *worker) value(id int) (string, *TestStruct) {
+	if w.replaying != nil && w.replaying.ValueSize > 0 {
+		return SizedTestStruct(id, w.replaying.ValueSize)
+	}
+	return w.wl.NewTestStruct(id)
+}
+
+// held hands a value read in the scope to the lease checker
+func (w *worker) held(v *TestStruct) {
+	if w.lease != nil {
+		w.lease.read(v)
+	}
+}
+
+// done ends the request scope, the lease checker compares the values read
+// around it
+func (w *worker) done(scope RequestScope) {
+	if w.lease != nil {
+		w.lease.beforeDone(&w.result)
+	}
+	start := w.now()
+	scope.Done()
+	w.observe(LatDone, start)
+	if w.lease != nil {
+		w.lease.afterDone(&w.result)
+	}
+}
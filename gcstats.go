@@ -0,0 +1,175 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+var gcMetricNames = []string{
+	"/gc/cycles/total:gc-cycles",
+	"/sched/pauses/total/gc:seconds",
+	"/gc/heap/live:bytes",
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/scan/heap:bytes",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+}
+
+// gcSample is one read of the runtime metrics we care about
+type gcSample struct {
+	cycles      uint64
+	pauses      *metrics.Float64Histogram
+	heapLive    uint64
+	heapAllocs  uint64
+	heapObjects uint64
+	heapScan    uint64
+	gcCPU       float64
+	totalCPU    float64 // GOMAXPROCS times the wall time, only updated by the GC
+}
+
+func readGCSample() gcSample {
+	samples := make([]metrics.Sample, len(gcMetricNames))
+	for i, name := range gcMetricNames {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	return gcSample{
+		cycles:      samples[0].Value.Uint64(),
+		pauses:      samples[1].Value.Float64Histogram(),
+		heapLive:    samples[2].Value.Uint64(),
+		heapAllocs:  samples[3].Value.Uint64(),
+		heapObjects: samples[4].Value.Uint64(),
+		heapScan:    samples[5].Value.Uint64(),
+		gcCPU:       samples[6].Value.Float64(),
+		totalCPU:    samples[7].Value.Float64(),
+	}
+}
+
+// GCStats is what the garbage collector did during a run, the heap numbers
+// are the state at the end of the run
+type GCStats struct {
+	Cycles        uint64        `json:"cycles"`
+	PauseTotal    time.Duration `json:"pause_total_ns"` // stop the world time, estimated from the pause histogram
+	PauseMax      time.Duration `json:"pause_max_ns"`   // upper bound of the longest pause bucket
+	HeapAlloc     uint64        `json:"heap_alloc_bytes"`
+	HeapLive      uint64        `json:"heap_live_bytes"`
+	HeapObjects   uint64        `json:"heap_objects"`
+	HeapScan      uint64        `json:"heap_scan_bytes"` // heap the GC has to scan, pointer free memory isn't part of it
+	GCCPUFraction float64       `json:"gc_cpu_fraction"`
+}
+
+// gcDelta compares the samples taken before and after a run
+func gcDelta(before, after gcSample) *GCStats {
+	stats := &GCStats{
+		Cycles:      after.cycles - before.cycles,
+		HeapAlloc:   after.heapAllocs - before.heapAllocs,
+		HeapLive:    after.heapLive,
+		HeapObjects: after.heapObjects,
+		HeapScan:    after.heapScan,
+	}
+	if cpu := after.totalCPU - before.totalCPU; cpu > 0 {
+		stats.GCCPUFraction = (after.gcCPU - before.gcCPU) / cpu
+	}
+	// the pause histogram only ever grows, the difference of the bucket
+	// counts are the pauses of this run
+	h := after.pauses
+	for i, c := range h.Counts {
+		n := c - before.pauses.Counts[i]
+		if n == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(lo, -1) {
+			lo = 0
+		}
+		if math.IsInf(hi, 1) {
+			hi = lo
+		}
+		stats.PauseTotal += time.Duration(float64(n) * (lo + hi) / 2 * float64(time.Second))
+		stats.PauseMax = time.Duration(hi * float64(time.Second))
+	}
+	return stats
+}
+
+func (s *GCStats) String() string {
+	return fmt.Sprintf("\nGC: cycles=%d pause=%s maxPause=%s cpu=%.2f%% alloc=%dMB live=%dMB scan=%dMB objects=%d",
+		s.Cycles, s.PauseTotal, s.PauseMax, s.GCCPUFraction*100,
+		s.HeapAlloc>>20, s.HeapLive>>20, s.HeapScan>>20, s.HeapObjects)
+}
+
+// appLoad stands for the rest of the process, it keeps a pointer rich live
+// set and allocates garbage, the time of every iteration shows how much the
+// GC work caused by the cache slows the application down
+type appLoad struct {
+	stop chan struct{}
+	done sync.WaitGroup
+	lat  Histogram
+}
+
+// AppStats is the work the background application got done during a run
+type AppStats struct {
+	Iterations uint64
+	Elapsed    time.Duration
+	Latency    Histogram
+}
+
+func (s *AppStats) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Iterations) / s.Elapsed.Seconds()
+}
+
+func (s *AppStats) String() string {
+	return fmt.Sprintf("\nApp: %.0f iterations/s p99=%s max=%s",
+		s.Throughput(), time.Duration(s.Latency.Quantile(0.99)), time.Duration(s.Latency.Max()))
+}
+
+type appNode struct {
+	next    *appNode
+	payload [64]byte
+}
+
+const (
+	appLiveSlots = 4096 // live lists kept by the application
+	appListLen   = 16   // nodes allocated per iteration
+)
+
+func startAppLoad() *appLoad {
+	a := &appLoad{stop: make(chan struct{})}
+	a.done.Add(1)
+	go func() {
+		defer a.done.Done()
+		live := make([]*appNode, appLiveSlots)
+		for i := 0; ; i++ {
+			select {
+			case <-a.stop:
+				return
+			default:
+			}
+			start := time.Now()
+			var head *appNode
+			for j := 0; j < appListLen; j++ {
+				head = &appNode{next: head}
+			}
+			// replacing a slot turns the old list into garbage
+			live[i%appLiveSlots] = head
+			a.lat.RecordSince(start)
+		}
+	}()
+	return a
+}
+
+func (a *appLoad) Stop(elapsed time.Duration) *AppStats {
+	close(a.stop)
+	a.done.Wait()
+	return &AppStats{
+		Iterations: a.lat.Count(),
+		Elapsed:    elapsed,
+		Latency:    a.lat,
+	}
+}
@@ -1,6 +1,10 @@
-package main
+package benchmark
 
 import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/yuadsl3010/heyicache"
@@ -8,4 +12,24 @@ import (
 
 func TestFnGenerateTool(t *testing.T) {
 	heyicache.GenCacheFn(TestStruct{}, true)
+	// the tool only writes the functions of a main package or of a package
+	// named like its directory, move them into this one
+	files, err := filepath.Glob("heyicache_fn_*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src = bytes.Replace(src, []byte("package main\n"), []byte("package benchmark\n"), 1)
+		src = bytes.ReplaceAll(src, []byte("benchmark.Test"), []byte("Test"))
+		if err := os.WriteFile(name, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
 }
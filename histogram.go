@@ -0,0 +1,209 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+const (
+	// every power of two is split into 64 linear sub buckets, so a recorded
+	// value is off by less than 1/64 (1.6%), like an HDR histogram with 2
+	// significant digits
+	histSubBits  = 6
+	histSubCount = 1 << histSubBits
+	// values above 2^40 ns (about 18 minutes) are clamped
+	histMaxBits    = 40
+	histBucketSize = (histMaxBits - histSubBits + 1) * histSubCount
+)
+
+// Histogram is a log-linear latency histogram in nanoseconds. It's not safe
+// for concurrent use, every goroutine records into its own one and they are
+// merged at the end of the run
+type Histogram struct {
+	counts []uint64
+	total  uint64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+func histIndex(v int64) int {
+	if v < histSubCount {
+		return int(max(v, 0))
+	}
+	if v >= 1<<histMaxBits {
+		return histBucketSize - 1
+	}
+	e := bits.Len64(uint64(v)) - histSubBits - 1
+	return (e+1)*histSubCount + int(v>>e) - histSubCount
+}
+
+// histValue is the highest value that falls into bucket idx
+func histValue(idx int) int64 {
+	if idx < histSubCount {
+		return int64(idx)
+	}
+	e := idx/histSubCount - 1
+	m := int64(idx%histSubCount + histSubCount)
+	return (m+1)<<e - 1
+}
+
+func (h *Histogram) Record(ns int64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, histBucketSize)
+	}
+	h.counts[histIndex(ns)]++
+	if h.total == 0 || ns < h.min {
+		h.min = ns
+	}
+	if ns > h.max {
+		h.max = ns
+	}
+	h.total++
+	h.sum += ns
+}
+
+// RecordSince records the time elapsed since start
+func (h *Histogram) RecordSince(start time.Time) {
+	h.Record(int64(time.Since(start)))
+}
+
+// Merge adds the samples of other into h
+func (h *Histogram) Merge(other *Histogram) {
+	if other.total == 0 {
+		return
+	}
+	if h.counts == nil {
+		h.counts = make([]uint64, histBucketSize)
+	}
+	for i, c := range other.counts {
+		h.counts[i] += c
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	h.max = max(h.max, other.max)
+	h.total += other.total
+	h.sum += other.sum
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.total
+}
+
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+func (h *Histogram) Min() int64 {
+	return h.min
+}
+
+func (h *Histogram) Mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return float64(h.sum) / float64(h.total)
+}
+
+// Quantile returns the value below which q (in [0, 1]) of the samples fall
+func (h *Histogram) Quantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(h.total) + 0.5)
+	rank = min(max(rank, 1), h.total)
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(histValue(i), h.max)
+		}
+	}
+	return h.max
+}
+
+// CDFPoint is the fraction of the samples at or below Ns
+type CDFPoint struct {
+	Ns       int64   `json:"ns"`
+	Fraction float64 `json:"fraction"`
+}
+
+// CDF returns one point per non empty bucket
+func (h *Histogram) CDF() []CDFPoint {
+	var points []CDFPoint
+	var seen uint64
+	for i, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		seen += c
+		points = append(points, CDFPoint{Ns: min(histValue(i), h.max), Fraction: float64(seen) / float64(h.total)})
+	}
+	return points
+}
+
+type LatencyOp uint8
+
+const (
+	LatGetHit LatencyOp = iota
+	LatGetMiss
+	LatSet
+	LatDel
+	LatDone // end of a request scope, heyicache's lease Done()
+	latOpCount
+)
+
+var latOpNames = [latOpCount]string{"get-hit", "get-miss", "set", "del", "done"}
+
+func (op LatencyOp) String() string {
+	return latOpNames[op]
+}
+
+// Quantiles reported for every operation type
+var reportQuantiles = []struct {
+	Name string
+	Q    float64
+}{
+	{"p50", 0.5},
+	{"p90", 0.9},
+	{"p99", 0.99},
+	{"p99.9", 0.999},
+}
+
+// LatencySet holds one histogram per operation type
+type LatencySet [latOpCount]Histogram
+
+func (l *LatencySet) Merge(other *LatencySet) {
+	for i := range l {
+		l[i].Merge(&other[i])
+	}
+}
+
+// Ops merges the histograms of the cache operations, the end of request
+// scopes is left out
+func (l *LatencySet) Ops() *Histogram {
+	all := &Histogram{}
+	for _, op := range []LatencyOp{LatGetHit, LatGetMiss, LatSet, LatDel} {
+		all.Merge(&l[op])
+	}
+	return all
+}
+
+func (l *LatencySet) String() string {
+	sb := &strings.Builder{}
+	for i := range l {
+		h := &l[i]
+		if h.Count() == 0 {
+			continue
+		}
+		fmt.Fprintf(sb, "\n%s: count=%d mean=%s", LatencyOp(i), h.Count(), time.Duration(h.Mean()))
+		for _, q := range reportQuantiles {
+			fmt.Fprintf(sb, " %s=%s", q.Name, time.Duration(h.Quantile(q.Q)))
+		}
+		fmt.Fprintf(sb, " max=%s", time.Duration(h.Max()))
+	}
+	return sb.String()
+}
@@ -0,0 +1,55 @@
+package benchmark
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+	h := &Histogram{}
+	for v := int64(1); v <= 100000; v++ {
+		h.Record(v)
+	}
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		want := q * 100000
+		got := float64(h.Quantile(q))
+		if got < want*0.98 || got > want*1.02 {
+			t.Fatalf("q%g: got %g, want %g ±2%%", q, got, want)
+		}
+	}
+	if h.Max() != 100000 || h.Min() != 1 || h.Count() != 100000 {
+		t.Fatalf("got min=%d max=%d count=%d", h.Min(), h.Max(), h.Count())
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	all, a, b := &Histogram{}, &Histogram{}, &Histogram{}
+	for i := 0; i < 10000; i++ {
+		v := r.Int64N(1 << 30)
+		all.Record(v)
+		if i%2 == 0 {
+			a.Record(v)
+		} else {
+			b.Record(v)
+		}
+	}
+	a.Merge(b)
+	for _, q := range []float64{0.5, 0.99} {
+		if a.Quantile(q) != all.Quantile(q) {
+			t.Fatalf("q%g: merged %d, want %d", q, a.Quantile(q), all.Quantile(q))
+		}
+	}
+	if a.Count() != all.Count() || a.Max() != all.Max() || a.Min() != all.Min() {
+		t.Fatalf("merged count/min/max differ")
+	}
+}
+
+func TestHistogramClamp(t *testing.T) {
+	h := &Histogram{}
+	h.Record(1 << 50)
+	h.Record(-1)
+	if h.Count() != 2 {
+		t.Fatalf("got count %d", h.Count())
+	}
+}
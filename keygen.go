@@ -0,0 +1,314 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyGenerator picks the record id of the next operation, every goroutine owns
+// one so Next doesn't need to be safe for concurrent use
+type KeyGenerator interface {
+	Next(r *rand.Rand) int
+}
+
+// keyInserter is implemented by generators where a write creates a new record
+// instead of updating an existing one, eg: YCSB's latest distribution
+type keyInserter interface {
+	NextInsert() int
+}
+
+// KeyDistribution builds the generators of one run, it's called once per run
+// so that the generators of different goroutines can share state
+type KeyDistribution interface {
+	Name() string
+	NewGenerators(records, goroutines int) []KeyGenerator
+}
+
+// UniformKeys picks every record with the same probability
+type UniformKeys struct{}
+
+func (UniformKeys) Name() string { return "uniform" }
+
+func (UniformKeys) NewGenerators(records, goroutines int) []KeyGenerator {
+	gens := make([]KeyGenerator, goroutines)
+	for i := range gens {
+		gens[i] = uniformGenerator(records)
+	}
+	return gens
+}
+
+type uniformGenerator int
+
+func (g uniformGenerator) Next(r *rand.Rand) int {
+	return r.IntN(int(g))
+}
+
+// ZipfianKeys makes record 0 the most popular one, the popularity of the
+// others decays with a power law of exponent Theta in (0, 1), YCSB uses 0.99
+type ZipfianKeys struct {
+	Theta float64
+}
+
+func (d ZipfianKeys) Name() string { return fmt.Sprintf("zipfian-%g", d.Theta) }
+
+func (d ZipfianKeys) NewGenerators(records, goroutines int) []KeyGenerator {
+	z := newZipf(records, d.Theta)
+	gens := make([]KeyGenerator, goroutines)
+	for i := range gens {
+		gens[i] = z
+	}
+	return gens
+}
+
+// zipf is the generator of "Quickly Generating Billion-Record Synthetic
+// Databases" (Gray et al.), the one YCSB uses. It's immutable after creation
+type zipf struct {
+	n     int
+	theta float64
+	alpha float64
+	zetan float64
+	eta   float64
+	half  float64 // 1 + 0.5^theta
+}
+
+var (
+	zetaLock  sync.Mutex
+	zetaCache = map[[2]float64]float64{}
+)
+
+// zeta is O(n), cache it since every run of a benchmark asks for the same one
+func zeta(n int, theta float64) float64 {
+	key := [2]float64{float64(n), theta}
+	zetaLock.Lock()
+	defer zetaLock.Unlock()
+	if v, ok := zetaCache[key]; ok {
+		return v
+	}
+	sum := 0.0
+	for i := 1; i <= n; i++ {
+		sum += 1 / math.Pow(float64(i), theta)
+	}
+	zetaCache[key] = sum
+	return sum
+}
+
+func newZipf(n int, theta float64) *zipf {
+	zetan := zeta(n, theta)
+	return &zipf{
+		n:     n,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zetan,
+		eta:   (1 - math.Pow(2/float64(n), 1-theta)) / (1 - zeta(2, theta)/zetan),
+		half:  1 + math.Pow(0.5, theta),
+	}
+}
+
+func (z *zipf) Next(r *rand.Rand) int {
+	u := r.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < z.half {
+		return 1
+	}
+	id := int(float64(z.n) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if id >= z.n {
+		id = z.n - 1
+	}
+	return id
+}
+
+// HotspotKeys sends HotOpPercent of the operations to the first HotKeyPercent
+// of the records, both parts are uniform inside
+type HotspotKeys struct {
+	HotKeyPercent float64
+	HotOpPercent  float64
+}
+
+func (d HotspotKeys) Name() string {
+	return fmt.Sprintf("hotspot-%g-%g", d.HotKeyPercent, d.HotOpPercent)
+}
+
+func (d HotspotKeys) NewGenerators(records, goroutines int) []KeyGenerator {
+	hot := int(float64(records) * d.HotKeyPercent / 100)
+	hot = max(1, min(hot, records))
+	g := &hotspotGenerator{records: records, hot: hot, hotOp: d.HotOpPercent / 100}
+	gens := make([]KeyGenerator, goroutines)
+	for i := range gens {
+		gens[i] = g
+	}
+	return gens
+}
+
+type hotspotGenerator struct {
+	records int
+	hot     int
+	hotOp   float64
+}
+
+func (g *hotspotGenerator) Next(r *rand.Rand) int {
+	if r.Float64() < g.hotOp || g.hot == g.records {
+		return r.IntN(g.hot)
+	}
+	return g.hot + r.IntN(g.records-g.hot)
+}
+
+// LatestKeys favours the most recently inserted records, writes insert new
+// records after the last one, like YCSB-D
+type LatestKeys struct {
+	Theta float64
+}
+
+func (d LatestKeys) Name() string { return fmt.Sprintf("latest-%g", d.Theta) }
+
+func (d LatestKeys) NewGenerators(records, goroutines int) []KeyGenerator {
+	g := &latestGenerator{zipf: newZipf(records, d.Theta)}
+	g.latest.Store(int64(records - 1))
+	gens := make([]KeyGenerator, goroutines)
+	for i := range gens {
+		gens[i] = g
+	}
+	return gens
+}
+
+type latestGenerator struct {
+	zipf   *zipf
+	latest atomic.Int64
+}
+
+func (g *latestGenerator) Next(r *rand.Rand) int {
+	return max(0, int(g.latest.Load())-g.zipf.Next(r))
+}
+
+func (g *latestGenerator) NextInsert() int {
+	return int(g.latest.Add(1))
+}
+
+// SequentialKeys walks the records in order. By default every goroutine walks
+// its own partition of the records, Shared makes all of them walk the same
+// sequence, that's the behavior of the original benchmark where every
+// goroutine hits the same key at the same moment
+type SequentialKeys struct {
+	Shared bool
+}
+
+func (d SequentialKeys) Name() string {
+	if d.Shared {
+		return "sequential-shared"
+	}
+	return "sequential"
+}
+
+func (d SequentialKeys) NewGenerators(records, goroutines int) []KeyGenerator {
+	gens := make([]KeyGenerator, goroutines)
+	for i := range gens {
+		if d.Shared || records < goroutines {
+			gens[i] = &sequentialGenerator{size: records}
+			continue
+		}
+		// the last partition takes the remainder
+		size := records / goroutines
+		start := i * size
+		if i == goroutines-1 {
+			size = records - start
+		}
+		gens[i] = &sequentialGenerator{start: start, size: size}
+	}
+	return gens
+}
+
+type sequentialGenerator struct {
+	start int
+	size  int
+	pos   int
+}
+
+func (g *sequentialGenerator) Next(*rand.Rand) int {
+	id := g.start + g.pos
+	g.pos++
+	if g.pos == g.size {
+		g.pos = 0
+	}
+	return id
+}
+
+// KeyDistributions are the distributions compared by BenchmarkKeyDistributions
+var KeyDistributions = []KeyDistribution{
+	UniformKeys{},
+	ZipfianKeys{Theta: 0.99},
+	HotspotKeys{HotKeyPercent: 20, HotOpPercent: 80},
+	LatestKeys{Theta: 0.99},
+	SequentialKeys{},
+	SequentialKeys{Shared: true},
+}
+
+func validateKeyDistribution(d KeyDistribution) error {
+	switch d := d.(type) {
+	case ZipfianKeys:
+		if d.Theta <= 0 || d.Theta >= 1 {
+			return fmt.Errorf("zipfian theta must be in (0, 1), got %g", d.Theta)
+		}
+	case LatestKeys:
+		if d.Theta <= 0 || d.Theta >= 1 {
+			return fmt.Errorf("latest theta must be in (0, 1), got %g", d.Theta)
+		}
+	case HotspotKeys:
+		if d.HotKeyPercent <= 0 || d.HotKeyPercent > 100 || d.HotOpPercent < 0 || d.HotOpPercent > 100 {
+			return fmt.Errorf("hotspot percentages must be in (0, 100], got keys=%g ops=%g", d.HotKeyPercent, d.HotOpPercent)
+		}
+	}
+	return nil
+}
+
+// ParseKeyDistribution parses the name of a distribution as printed by Name:
+// uniform, zipfian-0.99, hotspot-20-80, latest-0.99, sequential or
+// sequential-shared. The parameters can be left out: zipfian, hotspot and
+// latest default to the values of KeyDistributions
+func ParseKeyDistribution(s string) (KeyDistribution, error) {
+	name, rest, _ := strings.Cut(s, "-")
+	var params []float64
+	if rest != "" && name != "sequential" {
+		for _, p := range strings.Split(rest, "-") {
+			v, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return nil, fmt.Errorf("key distribution %q: %v", s, err)
+			}
+			params = append(params, v)
+		}
+	}
+	param := func(i int, def float64) float64 {
+		if i < len(params) {
+			return params[i]
+		}
+		return def
+	}
+	var d KeyDistribution
+	switch name {
+	case "uniform":
+		d = UniformKeys{}
+	case "zipfian":
+		d = ZipfianKeys{Theta: param(0, 0.99)}
+	case "hotspot":
+		d = HotspotKeys{HotKeyPercent: param(0, 20), HotOpPercent: param(1, 80)}
+	case "latest":
+		d = LatestKeys{Theta: param(0, 0.99)}
+	case "sequential":
+		if rest != "" && rest != "shared" {
+			return nil, fmt.Errorf("unknown key distribution %q", s)
+		}
+		d = SequentialKeys{Shared: rest == "shared"}
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", s)
+	}
+	if err := validateKeyDistribution(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
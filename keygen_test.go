@@ -0,0 +1,73 @@
+package benchmark
+
+import "testing"
+
+func TestKeyDistributionsStayInRange(t *testing.T) {
+	records, goroutines := 1000, 4
+	for _, d := range KeyDistributions {
+		if err := validateKeyDistribution(d); err != nil {
+			t.Fatal(err)
+		}
+		gens := d.NewGenerators(records, goroutines)
+		if len(gens) != goroutines {
+			t.Fatalf("%s: got %d generators, want %d", d.Name(), len(gens), goroutines)
+		}
+		for gIdx, gen := range gens {
+			r := newRand(1, gIdx)
+			for i := 0; i < 10000; i++ {
+				if id := gen.Next(r); id < 0 || id >= records {
+					t.Fatalf("%s: id %d out of [0, %d)", d.Name(), id, records)
+				}
+			}
+		}
+	}
+}
+
+func TestZipfianIsSkewed(t *testing.T) {
+	gen := ZipfianKeys{Theta: 0.99}.NewGenerators(1000, 1)[0]
+	r := newRand(1, 0)
+	hot := 0
+	for i := 0; i < 10000; i++ {
+		if gen.Next(r) < 10 {
+			hot++
+		}
+	}
+	// the first 1% of the records take about a third of the operations
+	if hot < 2000 {
+		t.Fatalf("zipfian: first 10 records got %d of 10000 operations", hot)
+	}
+}
+
+func TestSequentialPartitions(t *testing.T) {
+	gens := SequentialKeys{}.NewGenerators(10, 3)
+	seen := map[int]int{}
+	for gIdx, gen := range gens {
+		for i := 0; i < 4; i++ {
+			id := gen.Next(nil)
+			if owner, ok := seen[id]; ok && owner != gIdx {
+				t.Fatalf("id %d walked by goroutine %d and %d", id, owner, gIdx)
+			}
+			seen[id] = gIdx
+		}
+	}
+	if len(seen) != 10 {
+		t.Fatalf("got %d distinct ids, want 10", len(seen))
+	}
+}
+
+func TestParseKeyDistribution(t *testing.T) {
+	for _, d := range KeyDistributions {
+		got, err := ParseKeyDistribution(d.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != d {
+			t.Errorf("%s: got %#v, want %#v", d.Name(), got, d)
+		}
+	}
+	for _, s := range []string{"", "zipf", "zipfian-2", "hotspot-x", "sequential-1"} {
+		if _, err := ParseKeyDistribution(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package benchmark
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// LeaseCheck tells whether values read in a request scope are checked for
+// changes behind the reader's back. A value of a leased cache borrows cache
+// memory: it must not change while the lease is held, and after Done it
+// may, that's what the lease is for. Caches without a scope never change a
+// value they returned, they are the control group
+type LeaseCheck int
+
+const (
+	LeaseCheckOff    LeaseCheck = iota
+	LeaseCheckDuring            // snapshot every value read and compare it again after every later operation of the scope and before Done
+	LeaseCheckAfter             // keep values past Done under eviction pressure, then compare them
+)
+
+var leaseCheckNames = [...]string{"off", "during", "after"}
+
+func (c LeaseCheck) String() string {
+	if c >= 0 && int(c) < len(leaseCheckNames) {
+		return leaseCheckNames[c]
+	}
+	return fmt.Sprintf("lease-check(%d)", int(c))
+}
+
+func ParseLeaseCheck(s string) (LeaseCheck, error) {
+	if s == "" {
+		return LeaseCheckOff, nil
+	}
+	for i, name := range leaseCheckNames {
+		if name == s {
+			return LeaseCheck(i), nil
+		}
+	}
+	return LeaseCheckOff, fmt.Errorf("unknown lease check %q, want off, during or after", s)
+}
+
+const (
+	// maxHeldPerScope bounds the values snapshotted in one request scope
+	maxHeldPerScope = 8
+	// staleRing is the number of released values a goroutine keeps, a value
+	// is compared again after that many requests
+	staleRing = 16
+	// pressureGCEvery is the number of pressure writes between two forced
+	// collections, the collections free what only cache memory still
+	// references
+	pressureGCEvery = 4096
+)
+
+// heldValue is a value read from a cache and a deep copy of it taken when it
+// was read
+type heldValue struct {
+	value    *TestStruct
+	snapshot *TestStruct
+}
+
+// changed compares the value with its snapshot, the skip-tagged fields
+// aren't part of the snapshot
+func (h *heldValue) changed() []Mismatch {
+	v := &verifier{ignoreSkip: true}
+	v.walk("", reflect.ValueOf(h.value), reflect.ValueOf(h.snapshot))
+	return v.mismatches
+}
+
+// leaseChecker holds the values of one worker
+type leaseChecker struct {
+	mode  LeaseCheck
+	held  []heldValue // read in the current scope
+	stale []heldValue // released, oldest at next
+	next  int
+}
+
+func newLeaseChecker(mode LeaseCheck) *leaseChecker {
+	if mode == LeaseCheckOff {
+		return nil
+	}
+	return &leaseChecker{mode: mode}
+}
+
+// read is called with every value a Get of the scope returned
+func (c *leaseChecker) read(v *TestStruct) {
+	limit := maxHeldPerScope
+	if c.mode == LeaseCheckAfter {
+		limit = 1
+	}
+	if len(c.held) < limit {
+		c.held = append(c.held, heldValue{value: v, snapshot: deepCopy(v)})
+	}
+}
+
+// afterOp compares the values read in the scope before the operation that
+// just ended, the first held of them
+func (c *leaseChecker) afterOp(result *BenchResult, held int) {
+	if c.mode == LeaseCheckDuring {
+		c.checkHeld(result, c.held[:held])
+	}
+}
+
+// beforeDone compares the values read in the scope while the lease is still
+// held
+func (c *leaseChecker) beforeDone(result *BenchResult) {
+	if c.mode != LeaseCheckDuring {
+		return
+	}
+	c.checkHeld(result, c.held)
+	c.held = c.held[:0]
+}
+
+func (c *leaseChecker) checkHeld(result *BenchResult, held []heldValue) {
+	for i := range held {
+		result.LeaseChecked++
+		if mismatches := held[i].changed(); len(mismatches) > 0 {
+			result.LeaseCorrupt++
+			result.addMismatches(prefixMismatches("lease:", mismatches))
+		}
+	}
+}
+
+// afterDone keeps the value of the scope and compares the oldest one kept
+func (c *leaseChecker) afterDone(result *BenchResult) {
+	if c.mode != LeaseCheckAfter {
+		return
+	}
+	for _, h := range c.held {
+		if len(c.stale) < staleRing {
+			c.stale = append(c.stale, h)
+			continue
+		}
+		c.checkStale(result, &c.stale[c.next])
+		c.stale[c.next] = h
+		c.next = (c.next + 1) % staleRing
+	}
+	c.held = c.held[:0]
+}
+
+// flush compares the values still kept at the end of the run
+func (c *leaseChecker) flush(result *BenchResult) {
+	for i := range c.stale {
+		c.checkStale(result, &c.stale[i])
+	}
+	c.stale = nil
+}
+
+func (c *leaseChecker) checkStale(result *BenchResult, h *heldValue) {
+	result.StaleChecked++
+	if mismatches := h.changed(); len(mismatches) > 0 {
+		result.StaleCorrupt++
+		result.addMismatches(prefixMismatches("stale:", mismatches))
+	}
+}
+
+func prefixMismatches(prefix string, mismatches []Mismatch) []Mismatch {
+	for i := range mismatches {
+		mismatches[i].Path = prefix + mismatches[i].Path
+	}
+	return mismatches
+}
+
+// startPressure writes records beyond wl.Records into ifc and forces a
+// collection every pressureGCEvery writes until the returned stop is called:
+// blocks keep getting evicted and reused, and memory only the cache still
+// points to gets freed. The records cycle over twice the capacity of ifc, a
+// cache without one isn't pressured, it wouldn't evict but grow
+func startPressure(ifc CacheAdapter, wl *Workload) (stop func()) {
+	records := pressureRecords(ifc, wl)
+	if records == 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 1; ; n++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			k, v := newTestStruct(wl.Values, wl.Records+n%records)
+			_ = ifc.Set(k, v)
+			if n%pressureGCEvery == 0 {
+				runtime.GC()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// pressureRecords is the number of records filling twice the capacity of ifc,
+// sized like the first one written, 0 when ifc has no capacity
+func pressureRecords(ifc CacheAdapter, wl *Workload) int {
+	c, ok := ifc.(CapacityReporter)
+	if !ok || c.Capacity() <= 0 {
+		return 0
+	}
+	k, v := newTestStruct(wl.Values, wl.Records)
+	size := len(k) + int(HeyiCacheFnTestStructIfc_.Size(v, true))
+	if accounter, ok := ifc.(EntryAccounter); ok {
+		payload, overhead := accounter.EntryBytes(k, v)
+		size = len(k) + payload + overhead
+	}
+	return int(2*c.Capacity()/int64(size)) + 1
+}
+
+// deepCopy copies v and everything it points to into fresh Go memory,
+// strings included, so the copy doesn't share any byte with cache memory.
+// The skip-tagged fields are left zero: heyicache copies them with the
+// struct, they point to memory it doesn't keep alive and reading them can
+// hand a freed pointer to the garbage collector
+func deepCopy(v *TestStruct) *TestStruct {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface().(*TestStruct)
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		dst := reflect.New(v.Type().Elem())
+		dst.Elem().Set(copyValue(v.Elem()))
+		return dst
+	case reflect.Struct:
+		dst := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() && !isSkipped(f) {
+				dst.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return dst
+	case reflect.Array:
+		dst := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			dst.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return dst
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		dst := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			dst.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return dst
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+		dst := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			dst.SetMapIndex(copyValue(iter.Key()), copyValue(iter.Value()))
+		}
+		return dst
+	case reflect.String:
+		return reflect.ValueOf(strings.Clone(v.String())).Convert(v.Type())
+	}
+	dst := reflect.New(v.Type()).Elem()
+	dst.Set(v)
+	return dst
+}
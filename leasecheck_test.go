@@ -0,0 +1,110 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestDeepCopy(t *testing.T) {
+	_, v := NewTestStruct(3)
+	c := deepCopy(v)
+	if mismatches := (&heldValue{value: c, snapshot: v}).changed(); len(mismatches) > 0 {
+		t.Fatalf("copy differs: %v", mismatches)
+	}
+	if c.TestChild.TestSkip != "" || c.TestChildPtr.TestSkip != "" {
+		t.Fatal("the skip-tagged fields were copied")
+	}
+	if unsafe.StringData(c.TestChild.TestName) == unsafe.StringData(v.TestChild.TestName) ||
+		&c.TestProto.TestBytes[0] == &v.TestProto.TestBytes[0] {
+		t.Fatal("the copy shares memory with the value")
+	}
+}
+
+func TestLeaseChecker(t *testing.T) {
+	result := &BenchResult{}
+	c := newLeaseChecker(LeaseCheckDuring)
+	_, v := NewTestStruct(1)
+	c.read(v)
+	v.TestProto.TestStrings[1] = "overwritten"
+	// an operation reading another value, that one isn't compared yet
+	_, v2 := NewTestStruct(2)
+	c.read(v2)
+	c.afterOp(result, 1)
+	if result.LeaseChecked != 1 || result.LeaseCorrupt != 1 || result.Mismatches["lease:TestProto.TestStrings[1]"] != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	c.beforeDone(result)
+	if result.LeaseChecked != 3 || result.LeaseCorrupt != 2 || len(c.held) != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	result = &BenchResult{}
+	c = newLeaseChecker(LeaseCheckAfter)
+	for id := 0; id < staleRing+4; id++ {
+		_, v := NewTestStruct(id)
+		c.read(v)
+		c.read(v) // one value per scope
+		c.beforeDone(result)
+		c.afterDone(result)
+		if id == 0 {
+			v.Id = 42
+		}
+	}
+	if result.StaleChecked != 4 || result.StaleCorrupt != 1 || result.Mismatches["stale:Id"] != 1 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	c.flush(result)
+	if result.StaleChecked != staleRing+4 {
+		t.Fatalf("flush checked %d values", result.StaleChecked-4)
+	}
+}
+
+// TestLeaseCheckRun runs both checks against a cache without scope, whose
+// values never change, and against heyicache
+func TestLeaseCheckRun(t *testing.T) {
+	for _, mode := range []LeaseCheck{LeaseCheckDuring, LeaseCheckAfter} {
+		wl := DefaultWorkload
+		wl.Records = 1000
+		wl.Goroutines = 4
+		wl.LeaseCheck = mode
+		for _, cache := range []CacheAdapter{NewTestMap(wl.Records), NewTestHeyiCache(32)} {
+			result, err := runFor(cache, wl, 100*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked, corrupt := result.LeaseChecked, result.LeaseCorrupt
+			if mode == LeaseCheckAfter {
+				checked, corrupt = result.StaleChecked, result.StaleCorrupt
+			}
+			if checked == 0 {
+				t.Errorf("%s %s: nothing checked", cache.Name(), mode)
+			}
+			if cache.Name() == "Map" && corrupt > 0 {
+				t.Errorf("Map %s: %d values changed", mode, corrupt)
+			}
+			t.Logf("%s %s: %d of %d values changed", cache.Name(), mode, corrupt, checked)
+			for path, n := range result.Mismatches {
+				t.Logf("  %s: %d", path, n)
+			}
+		}
+	}
+}
+
+func TestPressureRecords(t *testing.T) {
+	wl := DefaultWorkload
+	if n := pressureRecords(NewTestMap(0), &wl); n != 0 {
+		t.Errorf("an unbounded map gets %d pressure records", n)
+	}
+	cache := NewTestFreeCache(16 << 20)
+	n := pressureRecords(cache, &wl)
+	for id := wl.Records; id < wl.Records+n; id++ {
+		k, v := NewTestStruct(id)
+		if err := cache.Set(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := cache.Get(GetKey(wl.Records)); ok {
+		t.Errorf("%d records didn't evict the first", n)
+	}
+}
@@ -0,0 +1,179 @@
+package benchmark
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+)
+
+// MemoryReport is how many bytes one cache really spends per entry. The
+// measured numbers come from the heap and the RSS of the process, the
+// accounted ones from what the cache says it stores (EntryAccounter)
+type MemoryReport struct {
+	Cache   string `json:"cache"`
+	Entries int    `json:"entries"` // entries written
+	Stored  int64  `json:"stored"`  // entries still in the cache, -1 when unknown
+
+	EmptyHeap     int64   `json:"empty_heap_bytes"` // heap of the empty cache (preallocated arenas, segments...)
+	HeapPerEntry  float64 `json:"heap_per_entry"`   // heap growth of the filled cache over the empty one, per stored entry
+	TotalPerEntry float64 `json:"total_per_entry"`  // whole heap of the filled cache per stored entry
+	RSSPerEntry   float64 `json:"rss_per_entry"`    // RSS growth per stored entry, 0 when RSS can't be read
+
+	KeyBytes      float64 `json:"key_bytes"`
+	PayloadBytes  float64 `json:"payload_bytes"`  // value as the cache stores it
+	HeaderBytes   float64 `json:"header_bytes"`   // entry header and index
+	OverheadBytes float64 `json:"overhead_bytes"` // measured total per entry minus key, payload and header
+
+	FlatBytes     float64 `json:"flat_bytes"`     // heyicache's flat size of the value (HeyiCacheFnTestStructIfc.Size)
+	ProtobufBytes float64 `json:"protobuf_bytes"` // length of the protobuf of the value
+}
+
+type MemoryReports []MemoryReport
+
+func (reports MemoryReports) csvHeader() []string {
+	return []string{"cache", "entries", "stored", "empty_heap_bytes", "heap_per_entry", "total_per_entry", "rss_per_entry",
+		"key_bytes", "payload_bytes", "header_bytes", "overhead_bytes", "flat_bytes", "protobuf_bytes"}
+}
+
+func (reports MemoryReports) csvRows() [][]string {
+	rows := make([][]string, 0, len(reports))
+	for _, r := range reports {
+		rows = append(rows, []string{
+			r.Cache,
+			strconv.Itoa(r.Entries),
+			strconv.FormatInt(r.Stored, 10),
+			strconv.FormatInt(r.EmptyHeap, 10),
+			formatFloat(r.HeapPerEntry, 1),
+			formatFloat(r.TotalPerEntry, 1),
+			formatFloat(r.RSSPerEntry, 1),
+			formatFloat(r.KeyBytes, 1),
+			formatFloat(r.PayloadBytes, 1),
+			formatFloat(r.HeaderBytes, 1),
+			formatFloat(r.OverheadBytes, 1),
+			formatFloat(r.FlatBytes, 1),
+			formatFloat(r.ProtobufBytes, 1),
+		})
+	}
+	return rows
+}
+
+func (r *MemoryReport) String() string {
+	return fmt.Sprintf("%s: stored=%d/%d heap/entry=%.0f total/entry=%.0f rss/entry=%.0f key=%.0f payload=%.0f header=%.0f overhead=%.0f flat=%.0f protobuf=%.0f",
+		r.Cache, r.Stored, r.Entries, r.HeapPerEntry, r.TotalPerEntry, r.RSSPerEntry,
+		r.KeyBytes, r.PayloadBytes, r.HeaderBytes, r.OverheadBytes, r.FlatBytes, r.ProtobufBytes)
+}
+
+// memSnapshot returns the live heap and the RSS after a full collection
+func memSnapshot() (heap int64, rss int64) {
+	runtime.GC()
+	debug.FreeOSMemory()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.HeapAlloc), readRSS()
+}
+
+// readRSS reads the resident set size from /proc, 0 when it's not available
+func readRSS() int64 {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+// measureResident sets the heap cache holds at the end of a run, over
+// heapBase measured before it was created, and the budget it was given. The
+// values the harness still references, eg: a pool, are only counted when
+// they were built after heapBase
+func (result *BenchResult) measureResident(cache CacheAdapter, heapBase int64) {
+	heap, _ := memSnapshot()
+	result.Resident = max(heap-heapBase, 1)
+	if c, ok := cache.(CapacityReporter); ok {
+		result.Budget = c.Capacity()
+	}
+	runtime.KeepAlive(cache)
+}
+
+// MeasureMemory fills a fresh cache with entries records, one at a time so
+// the heap only holds the cache, and reports what every entry costs
+func MeasureMemory(factory AdapterFactory, entries int) (*MemoryReport, error) {
+	report := &MemoryReport{Cache: factory.Name, Entries: entries, Stored: -1}
+
+	// the accounted sizes don't depend on the cache instance being measured
+	for id := 0; id < entries; id++ {
+		k, v := NewTestStruct(id)
+		report.KeyBytes += float64(len(k))
+		report.FlatBytes += float64(HeyiCacheFnTestStructIfc_.Size(v, true))
+		if pb, err := v.TestProto.Marshal(); err == nil {
+			report.ProtobufBytes += float64(len(pb))
+		}
+	}
+
+	heapBase, rssBase := memSnapshot()
+	cache, err := factory.New()
+	if err != nil {
+		return nil, fmt.Errorf("create %s: %v", factory.Name, err)
+	}
+	defer closeCache(cache)
+	heapEmpty, _ := memSnapshot()
+	report.EmptyHeap = heapEmpty - heapBase
+
+	accounter, _ := cache.(EntryAccounter)
+	for id := 0; id < entries; id++ {
+		k, v := NewTestStruct(id)
+		if accounter != nil {
+			payload, header := accounter.EntryBytes(k, v)
+			report.PayloadBytes += float64(payload)
+			report.HeaderBytes += float64(header)
+		}
+		_ = cache.Set(k, v)
+	}
+	heapFull, rssFull := memSnapshot()
+
+	stored := int64(entries)
+	if c, ok := cache.(EntryCounter); ok {
+		report.Stored = c.EntryCount()
+		stored = max(report.Stored, 1)
+	}
+	// the accounted sizes are averages over the written entries, the measured
+	// ones are spread over the stored entries since evicted ones cost nothing
+	scale := float64(entries)
+	report.KeyBytes /= scale
+	report.FlatBytes /= scale
+	report.ProtobufBytes /= scale
+	report.PayloadBytes /= scale
+	report.HeaderBytes /= scale
+	report.HeapPerEntry = float64(heapFull-heapEmpty) / float64(stored)
+	report.TotalPerEntry = float64(heapFull-heapBase) / float64(stored)
+	if rssBase > 0 {
+		report.RSSPerEntry = float64(rssFull-rssBase) / float64(stored)
+	}
+	report.OverheadBytes = report.TotalPerEntry - report.KeyBytes - report.PayloadBytes - report.HeaderBytes
+
+	runtime.KeepAlive(cache)
+	return report, nil
+}
+
+// MeasureMemoryAll runs MeasureMemory for every factory
+func MeasureMemoryAll(factories []AdapterFactory, entries int) (MemoryReports, error) {
+	var reports MemoryReports
+	for _, factory := range factories {
+		report, err := MeasureMemory(factory, entries)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
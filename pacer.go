@@ -0,0 +1,80 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"time"
+)
+
+type Arrival uint8
+
+const (
+	ArrivalConstant Arrival = iota // operations evenly spaced
+	ArrivalPoisson                 // exponential inter-arrival times
+)
+
+func (a Arrival) String() string {
+	switch a {
+	case ArrivalConstant:
+		return "constant"
+	case ArrivalPoisson:
+		return "poisson"
+	}
+	return fmt.Sprintf("arrival(%d)", a)
+}
+
+// spinThreshold is the wait below which the pacer yields instead of sleeping,
+// time.Sleep easily oversleeps by more than that
+const spinThreshold = time.Millisecond
+
+// pacer schedules the operations of one goroutine in open loop mode, the
+// schedule doesn't care how long the operations take, so a slow cache builds
+// up a queue instead of silently getting fewer requests
+type pacer struct {
+	r        *rand.Rand
+	arrival  Arrival
+	interval float64 // mean nanoseconds between two operations
+	next     time.Time
+}
+
+// newPacer splits rate evenly over goroutines, their first operations are
+// staggered over one interval so they don't fire together
+func newPacer(wl *Workload, r *rand.Rand, gIdx int, start time.Time) *pacer {
+	interval := float64(time.Second) * float64(wl.Goroutines) / wl.Rate
+	offset := time.Duration(interval * float64(gIdx) / float64(wl.Goroutines))
+	return &pacer{
+		r:        r,
+		arrival:  wl.Arrival,
+		interval: interval,
+		next:     start.Add(offset),
+	}
+}
+
+// wait blocks until the intended start of the next operation and returns how
+// far behind schedule the operation starts, that queueing delay is part of
+// its latency
+func (p *pacer) wait() time.Duration {
+	intended := p.next
+	gap := p.interval
+	if p.arrival == ArrivalPoisson {
+		gap = p.r.ExpFloat64() * p.interval
+	}
+	p.next = p.next.Add(time.Duration(gap))
+	return waitUntil(intended)
+}
+
+// waitUntil blocks until intended and returns how late it is by then
+func waitUntil(intended time.Time) time.Duration {
+	for {
+		d := time.Until(intended)
+		if d <= 0 {
+			return -d
+		}
+		if d > spinThreshold {
+			time.Sleep(d - spinThreshold)
+		} else {
+			runtime.Gosched()
+		}
+	}
+}
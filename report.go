@@ -0,0 +1,560 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report is everything a HTML report is drawn from, collected from result
+// documents and table documents
+type Report struct {
+	Environment *Environment
+	Runs        []RunDocument
+	Sweeps      map[string]SweepPoints    // by input file
+	Capacities  map[string]CapacityPoints // by input file
+	Memory      MemoryReports
+	Inputs      []string
+}
+
+// LoadReport reads every input, result documents (run, replay, compare
+// -save) as well as sweep and capacity tables written as JSON by heyibench
+// or by the go test sweeps
+func LoadReport(paths []string) (*Report, error) {
+	r := &Report{Sweeps: map[string]SweepPoints{}, Capacities: map[string]CapacityPoints{}}
+	for _, path := range paths {
+		if err := r.load(path); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		r.Inputs = append(r.Inputs, filepath.Base(path))
+	}
+	return r, nil
+}
+
+func (r *Report) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	var probe struct {
+		Kind        string          `json:"kind"`
+		Environment *Environment    `json:"environment"`
+		Runs        []RunDocument   `json:"runs"`
+		Rows        json.RawMessage `json:"rows"`
+	}
+	rows := json.RawMessage(data)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, &probe); err != nil {
+			return err
+		}
+		if probe.Environment != nil && r.Environment == nil {
+			r.Environment = probe.Environment
+		}
+		if probe.Runs != nil {
+			r.Runs = append(r.Runs, probe.Runs...)
+			return nil
+		}
+		rows = probe.Rows
+	}
+	kind := probe.Kind
+	if kind == "" {
+		kind = guessTableKind(rows)
+	}
+	switch kind {
+	case KindSweep:
+		var points SweepPoints
+		if err := json.Unmarshal(rows, &points); err != nil {
+			return err
+		}
+		r.Sweeps[name] = points
+	case KindCapacity:
+		var points CapacityPoints
+		if err := json.Unmarshal(rows, &points); err != nil {
+			return err
+		}
+		r.Capacities[name] = points
+	case KindMemory:
+		var reports MemoryReports
+		if err := json.Unmarshal(rows, &reports); err != nil {
+			return err
+		}
+		r.Memory = append(r.Memory, reports...)
+	default:
+		return fmt.Errorf("not a result or table document")
+	}
+	return nil
+}
+
+// guessTableKind recognizes the tables saved without a kind by the fields
+// of their first row
+func guessTableKind(rows json.RawMessage) string {
+	var probe []map[string]json.RawMessage
+	if json.Unmarshal(rows, &probe) != nil || len(probe) == 0 {
+		return ""
+	}
+	for field, kind := range map[string]string{"goroutines": KindSweep, "capacity_pct": KindCapacity, "heap_per_entry": KindMemory} {
+		if _, ok := probe[0][field]; ok {
+			return kind
+		}
+	}
+	return ""
+}
+
+// chart axes: linear, log10 or nines, nines spreads the tail of a
+// distribution: 0.9, 0.99 and 0.999 are equally far apart
+type axisScale uint8
+
+const (
+	scaleLinear axisScale = iota
+	scaleLog
+	scaleNines
+)
+
+func (s axisScale) apply(v float64) float64 {
+	switch s {
+	case scaleLog:
+		return math.Log10(math.Max(v, 1e-9))
+	case scaleNines:
+		return -math.Log10(math.Max(1-v, 1e-6))
+	}
+	return v
+}
+
+type axis struct {
+	label  string
+	scale  axisScale
+	format func(float64) string
+}
+
+// ticks returns the values to label between lo and hi, both in data units
+func (a *axis) ticks(lo, hi float64) []float64 {
+	var ticks []float64
+	switch a.scale {
+	case scaleLog:
+		for e := math.Floor(math.Log10(math.Max(lo, 1e-9))); e <= math.Ceil(math.Log10(math.Max(hi, 1e-9))); e++ {
+			ticks = append(ticks, math.Pow(10, e))
+		}
+	case scaleNines:
+		for _, q := range []float64{0, 0.5, 0.9, 0.99, 0.999, 0.9999, 0.99999} {
+			if q <= hi+1e-12 {
+				ticks = append(ticks, q)
+			}
+		}
+	default:
+		step := niceStep((hi - lo) / 5)
+		for v := math.Floor(lo/step) * step; v <= hi+step/2; v += step {
+			ticks = append(ticks, v)
+		}
+	}
+	return ticks
+}
+
+// niceStep rounds a tick step to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+type series struct {
+	name string
+	x, y []float64
+}
+
+var chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+
+const (
+	chartWidth  = 760
+	chartHeight = 380
+	chartLeft   = 80
+	chartRight  = 190 // room for the legend
+	chartTop    = 20
+	chartBottom = 50
+)
+
+// lineChart draws the series as a SVG line chart
+func lineChart(x, y axis, all []series) template.HTML {
+	var xs, ys []float64
+	for _, s := range all {
+		xs = append(xs, s.x...)
+		ys = append(ys, s.y...)
+	}
+	if len(xs) == 0 {
+		return ""
+	}
+	xTicks := x.ticks(minOf(xs), maxOf(xs))
+	yLo := minOf(ys)
+	if y.scale == scaleLinear {
+		yLo = math.Min(yLo, 0)
+	}
+	yTicks := y.ticks(yLo, maxOf(ys))
+	// the domain covers the data and the ticks
+	xMin, xMax := x.scale.apply(math.Min(minOf(xs), xTicks[0])), x.scale.apply(math.Max(maxOf(xs), xTicks[len(xTicks)-1]))
+	yMin, yMax := y.scale.apply(math.Min(yLo, yTicks[0])), y.scale.apply(math.Max(maxOf(ys), yTicks[len(yTicks)-1]))
+	plotW, plotH := float64(chartWidth-chartLeft-chartRight), float64(chartHeight-chartTop-chartBottom)
+	px := func(v float64) float64 {
+		if xMax == xMin {
+			return chartLeft + plotW/2
+		}
+		return chartLeft + (x.scale.apply(v)-xMin)/(xMax-xMin)*plotW
+	}
+	py := func(v float64) float64 {
+		if yMax == yMin {
+			return chartTop + plotH/2
+		}
+		return chartTop + plotH - (y.scale.apply(v)-yMin)/(yMax-yMin)*plotH
+	}
+
+	sb := &strings.Builder{}
+	svgOpen(sb)
+	for _, t := range xTicks {
+		fmt.Fprintf(sb, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#eee"/>`, px(t), chartTop, px(t), chartHeight-chartBottom)
+		fmt.Fprintf(sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, px(t), chartHeight-chartBottom+16, html.EscapeString(x.format(t)))
+	}
+	for _, t := range yTicks {
+		fmt.Fprintf(sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`, chartLeft, py(t), chartWidth-chartRight, py(t))
+		fmt.Fprintf(sb, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, chartLeft-6, py(t), html.EscapeString(y.format(t)))
+	}
+	svgAxes(sb, x.label, y.label)
+	for i, s := range all {
+		color := chartColors[i%len(chartColors)]
+		points := make([]string, len(s.x))
+		for j := range s.x {
+			points[j] = fmt.Sprintf("%.1f,%.1f", px(s.x[j]), py(s.y[j]))
+		}
+		fmt.Fprintf(sb, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+		if len(s.x) <= 32 {
+			for j := range s.x {
+				fmt.Fprintf(sb, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"/>`, px(s.x[j]), py(s.y[j]), color)
+			}
+		}
+		svgLegend(sb, i, s.name, color)
+	}
+	sb.WriteString("</svg>")
+	return template.HTML(sb.String())
+}
+
+// barChart draws one bar per label
+func barChart(yLabel string, format func(float64) string, labels []string, values []float64) template.HTML {
+	if len(values) == 0 {
+		return ""
+	}
+	yTicks := (&axis{}).ticks(0, maxOf(values))
+	yMax := math.Max(maxOf(values), yTicks[len(yTicks)-1])
+	if yMax == 0 {
+		yMax = 1
+	}
+	plotW, plotH := float64(chartWidth-chartLeft-chartRight), float64(chartHeight-chartTop-chartBottom)
+	py := func(v float64) float64 { return chartTop + plotH - v/yMax*plotH }
+	slot := plotW / float64(len(values))
+
+	sb := &strings.Builder{}
+	svgOpen(sb)
+	for _, t := range yTicks {
+		fmt.Fprintf(sb, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#eee"/>`, chartLeft, py(t), chartWidth-chartRight, py(t))
+		fmt.Fprintf(sb, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, chartLeft-6, py(t), html.EscapeString(format(t)))
+	}
+	svgAxes(sb, "", yLabel)
+	for i, v := range values {
+		color := chartColors[i%len(chartColors)]
+		x := chartLeft + slot*float64(i) + slot*0.15
+		fmt.Fprintf(sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+			x, py(v), slot*0.7, py(0)-py(v), color, html.EscapeString(labels[i]), html.EscapeString(format(v)))
+		svgLegend(sb, i, labels[i], color)
+	}
+	sb.WriteString("</svg>")
+	return template.HTML(sb.String())
+}
+
+func svgOpen(sb *strings.Builder) {
+	fmt.Fprintf(sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight, chartWidth, chartHeight)
+}
+
+func svgAxes(sb *strings.Builder, xLabel, yLabel string) {
+	fmt.Fprintf(sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`, chartLeft, chartHeight-chartBottom, chartWidth-chartRight, chartHeight-chartBottom)
+	fmt.Fprintf(sb, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#333"/>`, chartLeft, chartTop, chartLeft, chartHeight-chartBottom)
+	fmt.Fprintf(sb, `<text x="%d" y="%d" text-anchor="middle">%s</text>`, (chartLeft+chartWidth-chartRight)/2, chartHeight-10, html.EscapeString(xLabel))
+	fmt.Fprintf(sb, `<text transform="translate(16 %d) rotate(-90)" text-anchor="middle">%s</text>`, (chartTop+chartHeight-chartBottom)/2, html.EscapeString(yLabel))
+}
+
+func svgLegend(sb *strings.Builder, i int, name, color string) {
+	y := chartTop + 8 + i*16
+	fmt.Fprintf(sb, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, chartWidth-chartRight+12, y-5, color)
+	fmt.Fprintf(sb, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`, chartWidth-chartRight+28, y, html.EscapeString(name))
+}
+
+func minOf(values []float64) float64 {
+	m := math.Inf(1)
+	for _, v := range values {
+		m = math.Min(m, v)
+	}
+	return m
+}
+
+func maxOf(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
+
+func formatNs(v float64) string {
+	return time.Duration(v).String()
+}
+
+func formatPercentile(v float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("p%.3f", v*100), "0"), ".")
+}
+
+func formatCount(v float64) string {
+	switch {
+	case math.Abs(v) >= 1e6:
+		return fmt.Sprintf("%gM", math.Round(v/1e5)/10)
+	case math.Abs(v) >= 1e3:
+		return fmt.Sprintf("%gk", math.Round(v/1e2)/10)
+	}
+	return fmt.Sprintf("%g", math.Round(v*100)/100)
+}
+
+type reportChart struct {
+	Title string
+	Note  string
+	SVG   template.HTML
+}
+
+type reportRow struct {
+	Name, Config, Throughput, HitRate, P50, P99, GCPause string
+}
+
+// sortedInputs returns the keys of a map of input files in a stable order
+func sortedInputs[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// charts builds every chart the inputs have data for
+func (r *Report) charts() []reportChart {
+	var charts []reportChart
+
+	var sweep []series
+	for _, input := range sortedInputs(r.Sweeps) {
+		byCache := map[string]*series{}
+		var order []string
+		for _, p := range r.Sweeps[input] {
+			name := p.Cache
+			if len(r.Sweeps) > 1 {
+				name += " (" + input + ")"
+			}
+			s := byCache[name]
+			if s == nil {
+				s = &series{name: name}
+				byCache[name] = s
+				order = append(order, name)
+			}
+			s.x = append(s.x, float64(p.Goroutines))
+			s.y = append(s.y, p.Throughput)
+		}
+		for _, name := range order {
+			sweep = append(sweep, *byCache[name])
+		}
+	}
+	if len(sweep) > 0 {
+		charts = append(charts, reportChart{
+			Title: "Throughput vs goroutines",
+			SVG: lineChart(axis{"goroutines", scaleLog, formatCount},
+				axis{"ops/s", scaleLinear, formatCount}, sweep),
+		})
+	}
+
+	// one CDF chart per operation type, one line per run
+	cdfs := map[string][]series{}
+	var ops []string
+	for _, run := range r.Runs {
+		for _, cdf := range run.Latency {
+			if cdf.Op == LatDone.String() {
+				continue
+			}
+			if _, ok := cdfs[cdf.Op]; !ok {
+				ops = append(ops, cdf.Op)
+			}
+			s := series{name: run.Name}
+			for _, p := range cdf.Points {
+				s.x = append(s.x, float64(max(p.Ns, 1)))
+				s.y = append(s.y, p.Fraction)
+			}
+			cdfs[cdf.Op] = append(cdfs[cdf.Op], s)
+		}
+	}
+	for _, op := range ops {
+		charts = append(charts, reportChart{
+			Title: "Latency CDF: " + op,
+			Note:  "the vertical axis spreads the tail: p90, p99 and p99.9 are equally far apart",
+			SVG: lineChart(axis{"latency", scaleLog, formatNs},
+				axis{"percentile", scaleNines, formatPercentile}, cdfs[op]),
+		})
+	}
+
+	var capacity []series
+	for _, input := range sortedInputs(r.Capacities) {
+		byCache := map[string]*series{}
+		var order []string
+		for _, p := range r.Capacities[input] {
+			name := p.Cache
+			if len(r.Capacities) > 1 {
+				name += " (" + input + ")"
+			}
+			s := byCache[name]
+			if s == nil {
+				s = &series{name: name}
+				byCache[name] = s
+				order = append(order, name)
+			}
+			s.x = append(s.x, p.CapacityPct)
+			s.y = append(s.y, p.HitRate)
+		}
+		for _, name := range order {
+			capacity = append(capacity, *byCache[name])
+		}
+	}
+	if len(capacity) > 0 {
+		charts = append(charts, reportChart{
+			Title: "Hit ratio vs capacity",
+			SVG: lineChart(axis{"capacity (% of the working set)", scaleLinear, formatCount},
+				axis{"hit %", scaleLinear, formatCount}, capacity),
+		})
+	}
+
+	var labels []string
+	var maxPause, gcCPU []float64
+	for _, run := range r.Runs {
+		pause, ok := run.Metric("gc-max-pause-ns")
+		if !ok {
+			continue
+		}
+		cpu, _ := run.Metric("gc-cpu%")
+		labels = append(labels, run.Name)
+		maxPause = append(maxPause, pause)
+		gcCPU = append(gcCPU, cpu)
+	}
+	if len(labels) > 0 {
+		charts = append(charts,
+			reportChart{Title: "GC: longest pause", SVG: barChart("max pause", formatNs, labels, maxPause)},
+			reportChart{Title: "GC: CPU share", SVG: barChart("GC CPU %", formatCount, labels, gcCPU)},
+		)
+	}
+
+	if len(r.Memory) > 0 {
+		labels, values := make([]string, len(r.Memory)), make([]float64, len(r.Memory))
+		for i, m := range r.Memory {
+			labels[i], values[i] = m.Cache, m.TotalPerEntry
+		}
+		charts = append(charts, reportChart{Title: "Heap bytes per entry", SVG: barChart("bytes", formatCount, labels, values)})
+	}
+	return charts
+}
+
+func (r *Report) rows() []reportRow {
+	rows := make([]reportRow, 0, len(r.Runs))
+	metric := func(run *RunDocument, name string, format func(float64) string) string {
+		if v, ok := run.Metric(name); ok {
+			return format(v)
+		}
+		return ""
+	}
+	for i := range r.Runs {
+		run := &r.Runs[i]
+		row := reportRow{
+			Name:       run.Name,
+			Config:     run.Cache.Config,
+			Throughput: metric(run, "ops/s", formatCount),
+			HitRate:    metric(run, "hit%", func(v float64) string { return fmt.Sprintf("%.2f%%", v) }),
+			GCPause:    metric(run, "gc-max-pause-ns", formatNs),
+		}
+		for _, cdf := range run.Latency {
+			if cdf.Op == LatGetHit.String() {
+				row.P50 = formatNs(cdfQuantile(cdf.Points, 0.5))
+				row.P99 = formatNs(cdfQuantile(cdf.Points, 0.99))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func cdfQuantile(points []CDFPoint, q float64) float64 {
+	for _, p := range points {
+		if p.Fraction >= q {
+			return float64(p.Ns)
+		}
+	}
+	if len(points) == 0 {
+		return 0
+	}
+	return float64(points[len(points)-1].Ns)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>heyicache benchmark report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child, td.config { text-align: left; }
+.note { color: #666; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>heyicache benchmark report</h1>
+{{with .Env}}<p class="note">{{.GoVersion}} {{.GOOS}}/{{.GOARCH}}, GOMAXPROCS={{.GOMAXPROCS}}, {{.CPU}}, {{.Time.Format "2006-01-02 15:04 MST"}}</p>{{end}}
+<p class="note">inputs: {{range $i, $in := .Inputs}}{{if $i}}, {{end}}{{$in}}{{end}}</p>
+{{if .Rows}}
+<h2>Runs</h2>
+<table>
+<tr><th>run</th><th>config</th><th>ops/s</th><th>hit</th><th>get-hit p50</th><th>get-hit p99</th><th>GC max pause</th></tr>
+{{range .Rows}}<tr><td>{{.Name}}</td><td class="config">{{.Config}}</td><td>{{.Throughput}}</td><td>{{.HitRate}}</td><td>{{.P50}}</td><td>{{.P99}}</td><td>{{.GCPause}}</td></tr>
+{{end}}</table>
+{{end}}
+{{range .Charts}}
+<h2>{{.Title}}</h2>
+{{if .Note}}<p class="note">{{.Note}}</p>{{end}}
+{{.SVG}}
+{{end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as one self-contained HTML page with inline
+// SVG charts
+func (r *Report) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, struct {
+		Env    *Environment
+		Inputs []string
+		Rows   []reportRow
+		Charts []reportChart
+	}{r.Environment, r.Inputs, r.rows(), r.charts()})
+}
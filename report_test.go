@@ -0,0 +1,57 @@
+package benchmark
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportFromResultFiles(t *testing.T) {
+	dir := t.TempDir()
+	wl := DefaultWorkload
+	result := &BenchResult{ReadSuccess: 3, Elapsed: time.Second, Latency: &LatencySet{}, GC: &GCStats{PauseMax: time.Millisecond}}
+	for _, ns := range []int64{100, 200, 5000} {
+		result.Latency[LatGetHit].Record(ns)
+	}
+	doc := NewResultDocument()
+	doc.Runs = append(doc.Runs, NewRunDocument(NewTestMap(16), &wl, result))
+	runs := filepath.Join(dir, "runs.json")
+	if err := SaveTable(runs, doc); err != nil {
+		t.Fatal(err)
+	}
+	// the go test sweep saves the bare rows
+	sweep := filepath.Join(dir, "sweep.json")
+	if err := SaveTable(sweep, SweepPoints{{Cache: "Map", Goroutines: 1, Throughput: 10}, {Cache: "Map", Goroutines: 2, Throughput: 20}}); err != nil {
+		t.Fatal(err)
+	}
+	capacity := filepath.Join(dir, "capacity.json")
+	f, err := os.Create(capacity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(f, NewTableDocument(CapacityPoints{{Cache: "FreeCache", CapacityPct: 50, HitRate: 40}}, nil)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	r, err := LoadReport([]string{runs, sweep, capacity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := r.WriteHTML(buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{"Throughput vs goroutines", "Latency CDF: get-hit", "Hit ratio vs capacity", "GC: longest pause", "Map/default"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report misses %q", want)
+		}
+	}
+	if strings.Contains(page, "NaN") || strings.Contains(page, "Inf") {
+		t.Error("report has a NaN or Inf coordinate")
+	}
+}
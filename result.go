@@ -0,0 +1,366 @@
+package benchmark
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment is the machine and the build a result was measured with
+type Environment struct {
+	GoVersion  string            `json:"go_version"`
+	GOOS       string            `json:"goos"`
+	GOARCH     string            `json:"goarch"`
+	GOMAXPROCS int               `json:"gomaxprocs"`
+	NumCPU     int               `json:"num_cpu"`
+	CPU        string            `json:"cpu"`
+	Hostname   string            `json:"hostname"`
+	Time       time.Time         `json:"time"`
+	Deps       map[string]string `json:"deps,omitempty"` // module versions of the caches under test
+}
+
+// benchPkg is the pkg line of the benchmark output
+const benchPkg = "github.com/yuadsl3010/heyicache-benchmark"
+
+func CurrentEnvironment() Environment {
+	env := Environment{
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+		CPU:        cpuModel(),
+		Time:       time.Now().UTC().Truncate(time.Second),
+	}
+	env.Hostname, _ = os.Hostname()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		env.Deps = map[string]string{}
+		for _, dep := range info.Deps {
+			version := dep.Version
+			if dep.Replace != nil {
+				version = dep.Replace.Path
+				if dep.Replace.Version != "" {
+					version += "@" + dep.Replace.Version
+				}
+			}
+			env.Deps[dep.Path] = version
+		}
+	}
+	return env
+}
+
+// cpuModel reads the model name from /proc, the architecture when it's not
+// available
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return runtime.GOARCH
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return runtime.GOARCH
+}
+
+// CacheInfo is the configuration of a cache under test
+type CacheInfo struct {
+	Name         string `json:"name"`
+	Config       string `json:"config,omitempty"`
+	Capacity     int64  `json:"capacity_bytes"` // -1 when unbounded
+	Capabilities string `json:"capabilities"`
+}
+
+func DescribeCache(ifc CacheAdapter) CacheInfo {
+	info := CacheInfo{
+		Name:         ifc.Name(),
+		Capacity:     -1,
+		Capabilities: Capabilities(ifc).String(),
+	}
+	if c, ok := ifc.(ConfigReporter); ok {
+		info.Config = c.Config()
+	}
+	if c, ok := ifc.(CapacityReporter); ok && c.Capacity() > 0 {
+		info.Capacity = c.Capacity()
+	}
+	return info
+}
+
+// WorkloadParams are the parameters of a workload as they are recorded in a
+// result document
+type WorkloadParams struct {
+	Name          string  `json:"name"`
+	Read          float64 `json:"read_pct"`
+	Write         float64 `json:"write_pct"`
+	Delete        float64 `json:"delete_pct"`
+	Verify        float64 `json:"verify_pct"`
+	Peek          float64 `json:"peek_pct"`
+	Keys          string  `json:"keys"`
+	Records       int     `json:"records"`
+	Goroutines    int     `json:"goroutines"`
+	OpsPerRequest int     `json:"ops_per_request"`
+	Seed          uint64  `json:"seed"`
+	Preload       bool    `json:"preload"`
+	FillOnMiss    bool    `json:"fill_on_miss"`
+	AppLoad       bool    `json:"app_load"`
+	ReadModify    bool    `json:"read_modify_write,omitempty"`
+	Rate          float64 `json:"rate,omitempty"`
+	Arrival       string  `json:"arrival,omitempty"`
+	Values        string  `json:"values,omitempty"` // value profile, empty is the default shape
+	Pool          string  `json:"pool,omitempty"`   // empty when keys and values are built in the measured loop
+	LeaseCheck    string  `json:"lease_check,omitempty"`
+	TTL           string  `json:"ttl,omitempty"`      // ttl distribution, empty never expires
+	SimTick       string  `json:"sim_tick,omitempty"` // simulated time per operation, empty on the system clock
+	BaselineLoop  bool    `json:"baseline_loop,omitempty"`
+}
+
+func (wl *Workload) Params() WorkloadParams {
+	p := WorkloadParams{
+		Name:          wl.Name,
+		Read:          wl.Read,
+		Write:         wl.Write,
+		Delete:        wl.Delete,
+		Verify:        wl.Verify,
+		Peek:          wl.Peek,
+		Records:       wl.Records,
+		Goroutines:    wl.Goroutines,
+		OpsPerRequest: wl.OpsPerRequest,
+		Seed:          wl.Seed,
+		Preload:       wl.Preload,
+		FillOnMiss:    wl.FillOnMiss,
+		AppLoad:       wl.AppLoad,
+		ReadModify:    wl.ReadModify,
+		Rate:          wl.Rate,
+		BaselineLoop:  wl.BaselineLoop,
+	}
+	if wl.Keys != nil {
+		p.Keys = wl.Keys.Name()
+	}
+	if wl.Rate > 0 {
+		p.Arrival = wl.Arrival.String()
+	}
+	if wl.Values != nil {
+		p.Values = wl.Values.Name
+	}
+	if wl.Pool != PoolOff {
+		p.Pool = wl.Pool.String()
+	}
+	if wl.LeaseCheck != LeaseCheckOff {
+		p.LeaseCheck = wl.LeaseCheck.String()
+	}
+	if wl.TTL != nil {
+		p.TTL = wl.TTL.Name()
+	}
+	if wl.SimTick > 0 {
+		p.SimTick = wl.SimTick.String()
+	}
+	return p
+}
+
+// RunDocument is one run of one cache with all of its metrics
+type RunDocument struct {
+	Name     string         `json:"name"` // benchmark name, <cache>/<workload>
+	Cache    CacheInfo      `json:"cache"`
+	Workload WorkloadParams `json:"workload"`
+	Elapsed  float64        `json:"elapsed_s"`
+	Ops      uint64         `json:"ops"`
+	Metrics  []Metric       `json:"metrics"`
+	Latency  []LatencyCDF   `json:"latency,omitempty"`
+
+	// Mismatches counts the failed verifications per field path
+	Mismatches map[string]uint64 `json:"mismatches,omitempty"`
+
+	result *BenchResult
+}
+
+// LatencyCDF is the latency distribution of one operation type
+type LatencyCDF struct {
+	Op     string     `json:"op"`
+	Points []CDFPoint `json:"points"`
+}
+
+func NewRunDocument(ifc CacheAdapter, wl *Workload, result *BenchResult) RunDocument {
+	doc := RunDocument{
+		Name:     benchName(ifc.Name() + "/" + wl.Name),
+		Cache:    DescribeCache(ifc),
+		Workload: wl.Params(),
+		Elapsed:  result.Elapsed.Seconds(),
+		Ops:      result.Ops(),
+		Metrics:  result.Metrics(),
+
+		Mismatches: result.Mismatches,
+		result:     result,
+	}
+	if result.Latency != nil {
+		for i := range result.Latency {
+			if h := &result.Latency[i]; h.Count() > 0 {
+				doc.Latency = append(doc.Latency, LatencyCDF{Op: LatencyOp(i).String(), Points: h.CDF()})
+			}
+		}
+	}
+	return doc
+}
+
+// Metric returns the value of the metric called name
+func (doc *RunDocument) Metric(name string) (float64, bool) {
+	for _, m := range doc.Metrics {
+		if m.Name == name {
+			return m.Value, true
+		}
+	}
+	return 0, false
+}
+
+// benchName makes name a valid benchmark name the way go test does, spaces
+// become underscores
+func benchName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// ResultDocument is the structured output of one heyibench invocation
+type ResultDocument struct {
+	Environment Environment   `json:"environment"`
+	Settings    RunSettings   `json:"settings"`
+	Runs        []RunDocument `json:"runs"`
+}
+
+// RunSettings are the settings of the runs that aren't part of their
+// workload, compare reruns the baseline with them
+type RunSettings struct {
+	Duration float64 `json:"duration_s,omitempty"`  // of every run, 0 when unknown
+	Capacity int     `json:"capacity_mb,omitempty"` // given to every cache, 0 when they kept their default configuration
+}
+
+func NewResultDocument() *ResultDocument {
+	return &ResultDocument{Environment: CurrentEnvironment()}
+}
+
+// metricNames is the union of the metric names of all runs, in the order
+// they first appear
+func (doc *ResultDocument) metricNames() []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, run := range doc.Runs {
+		for _, m := range run.Metrics {
+			if !seen[m.Name] {
+				seen[m.Name] = true
+				names = append(names, m.Name)
+			}
+		}
+	}
+	return names
+}
+
+func (doc *ResultDocument) csvHeader() []string {
+	header := []string{"name", "cache", "cache_config", "workload", "keys", "values", "pool", "records", "goroutines", "ops_per_request", "rate",
+		"go_version", "gomaxprocs", "cpu", "elapsed_s", "ops"}
+	return append(header, doc.metricNames()...)
+}
+
+func (doc *ResultDocument) csvRows() [][]string {
+	names := doc.metricNames()
+	env := &doc.Environment
+	rows := make([][]string, 0, len(doc.Runs))
+	for _, run := range doc.Runs {
+		wl := &run.Workload
+		row := []string{
+			run.Name,
+			run.Cache.Name,
+			run.Cache.Config,
+			wl.Name,
+			wl.Keys,
+			wl.Values,
+			wl.Pool,
+			strconv.Itoa(wl.Records),
+			strconv.Itoa(wl.Goroutines),
+			strconv.Itoa(wl.OpsPerRequest),
+			formatFloat(wl.Rate, 0),
+			env.GoVersion,
+			strconv.Itoa(env.GOMAXPROCS),
+			env.CPU,
+			formatFloat(run.Elapsed, 3),
+			strconv.FormatUint(run.Ops, 10),
+		}
+		for _, name := range names {
+			if v, ok := run.Metric(name); ok {
+				row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteBenchstat writes doc in the go test -bench format, one line per run
+// with the operations as iterations, so benchstat can compare two files
+func (doc *ResultDocument) WriteBenchstat(w io.Writer) error {
+	env := &doc.Environment
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "goos: %s\ngoarch: %s\npkg: %s\ncpu: %s\n", env.GOOS, env.GOARCH, benchPkg, env.CPU)
+	for _, run := range doc.Runs {
+		nsPerOp := 0.0
+		if run.Ops > 0 {
+			nsPerOp = run.Elapsed * 1e9 / float64(run.Ops)
+		}
+		fmt.Fprintf(bw, "Benchmark%s-%d\t%d\t%s ns/op", run.Name, env.GOMAXPROCS, run.Ops, strconv.FormatFloat(nsPerOp, 'f', 2, 64))
+		for _, m := range run.Metrics {
+			fmt.Fprintf(bw, "\t%s %s", strconv.FormatFloat(m.Value, 'g', -1, 64), m.Name)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// WriteText prints every run with its full result
+func (doc *ResultDocument) WriteText(w io.Writer) error {
+	for _, run := range doc.Runs {
+		s := ""
+		if run.result != nil {
+			s = run.result.String()
+		}
+		if _, err := fmt.Fprintf(w, "=== %s %s%s\n\n", run.Name, run.Cache.Config, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TableDocument wraps the rows of a sweep or a measurement with the
+// environment they were measured in, Kind tells which table the rows are
+type TableDocument struct {
+	Kind        string          `json:"kind"`
+	Environment Environment     `json:"environment"`
+	Workload    *WorkloadParams `json:"workload,omitempty"`
+	Rows        csvTable        `json:"rows"`
+}
+
+const (
+	KindSweep    = "sweep"
+	KindCapacity = "capacity"
+	KindMemory   = "memory"
+)
+
+func NewTableDocument(t csvTable, wl *WorkloadParams) *TableDocument {
+	doc := &TableDocument{Environment: CurrentEnvironment(), Workload: wl, Rows: t}
+	switch t.(type) {
+	case SweepPoints:
+		doc.Kind = KindSweep
+	case CapacityPoints:
+		doc.Kind = KindCapacity
+	case MemoryReports:
+		doc.Kind = KindMemory
+	}
+	return doc
+}
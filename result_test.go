@@ -0,0 +1,34 @@
+package benchmark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultDocumentBenchstat(t *testing.T) {
+	wl := DefaultWorkload
+	result := &BenchResult{ReadSuccess: 90, ReadMiss: 10, Elapsed: time.Second}
+	doc := NewResultDocument()
+	doc.Runs = append(doc.Runs, NewRunDocument(NewTestMap(16), &wl, result))
+
+	buf := &bytes.Buffer{}
+	if err := doc.WriteBenchstat(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	last := lines[len(lines)-1]
+	if !strings.HasPrefix(last, "BenchmarkMap/default-") {
+		t.Fatalf("unexpected benchmark line %q", last)
+	}
+	fields := strings.Split(last, "\t")
+	if fields[1] != "100" || fields[2] != "10000000.00 ns/op" || fields[3] != "90 hit%" {
+		t.Fatalf("unexpected benchmark line %q", last)
+	}
+
+	header, rows := doc.csvHeader(), doc.csvRows()
+	if len(rows) != 1 || len(rows[0]) != len(header) {
+		t.Fatalf("csv rows don't match the header: %v %v", header, rows)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package benchmark
+
+import "time"
+
+// processCPU isn't measured on this platform, the CPU metrics are left out
+func processCPU() time.Duration {
+	return 0
+}
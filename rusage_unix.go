@@ -0,0 +1,18 @@
+//go:build unix
+
+package benchmark
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPU is the user and system CPU time the process used so far, 0 when
+// the kernel doesn't tell
+func processCPU() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
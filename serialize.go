@@ -1,44 +1,601 @@
-package main
+package benchmark
 
-import "unsafe"
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"unsafe"
+)
 
-// SerializeTestStruct 将 TestStruct 序列化为字节数组
-// 使用 protobuf 只序列化 TestProto 字段，因为 TestStruct 本身不是 protobuf 消息
-// 这样可以减少序列化开销，专注于 protobuf 性能测试
-func SerializeTestStruct(ts *TestStruct) ([]byte, error) {
-	if ts == nil || ts.TestProto == nil {
+// Codec 把 TestStruct 编码成字节数组，freecache、bigcache 这类只能保存字节的 cache 用它读写
+type Codec interface {
+	Name() string
+	Encode(ts *TestStruct) ([]byte, error)
+	Decode(data []byte) (*TestStruct, error)
+	// VerifyMode 返回解码出来的值怎么校验，即编码保存了哪些字段
+	VerifyMode() VerifyMode
+}
+
+// CodecSetter 由使用 Codec 的 cache 实现，SetCodec 要在第一次读写之前调用
+type CodecSetter interface {
+	SetCodec(c Codec)
+}
+
+var (
+	// BinaryCodec 是 SerializeTestStruct 的手写编码，保存的内容和 heyicache 一致
+	BinaryCodec Codec = binaryCodec{}
+	// ProtobufCodec 用 gogo protobuf 只保存 TestProto 字段
+	ProtobufCodec Codec = protobufCodec{}
+	// GobCodec 用 encoding/gob 保存整个 TestStruct，每个值都带着类型信息
+	GobCodec Codec = gobCodec{}
+	// JSONCodec 用 encoding/json 保存整个 TestStruct
+	JSONCodec Codec = jsonCodec{}
+
+	// DefaultCodec 是字节型 cache 默认使用的 Codec
+	DefaultCodec = BinaryCodec
+)
+
+var baseCodecs = []Codec{ProtobufCodec, GobCodec, JSONCodec, BinaryCodec}
+
+// CodecNames 返回默认的 codec 组合：每个基础 codec，以及 binary 的两种压缩版本
+func CodecNames() []string {
+	names := make([]string, 0, len(baseCodecs)+len(compressors))
+	for _, c := range baseCodecs {
+		names = append(names, c.Name())
+	}
+	for _, c := range compressors {
+		names = append(names, BinaryCodec.Name()+"+"+c.name)
+	}
+	return names
+}
+
+// ParseCodec 解析 codec 名字，name+flate 或 name+zlib 表示压缩后的版本，如 binary+zlib
+func ParseCodec(name string) (Codec, error) {
+	base, compression, compressed := strings.Cut(name, "+")
+	for _, c := range baseCodecs {
+		if c.Name() != base {
+			continue
+		}
+		if !compressed {
+			return c, nil
+		}
+		for _, comp := range compressors {
+			if comp.name == compression {
+				return comp.wrap(c), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown compression %q, want flate or zlib", compression)
+	}
+	return nil, fmt.Errorf("unknown codec %q, want one of %s", name, strings.Join(CodecNames(), ", "))
+}
+
+// ParseCodecs 解析逗号分隔的 codec 名字，all 表示 CodecNames
+func ParseCodecs(list string) ([]Codec, error) {
+	if list == "" {
 		return nil, nil
 	}
+	names := strings.Split(list, ",")
+	if list == "all" {
+		names = CodecNames()
+	}
+	codecs := make([]Codec, 0, len(names))
+	for _, name := range names {
+		c, err := ParseCodec(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		codecs = append(codecs, c)
+	}
+	return codecs, nil
+}
+
+// codecSuffix 是 cache 名字里 codec 的部分，默认的 codec 没有后缀，这样已有的结果还能对上
+func codecSuffix(c Codec) string {
+	if c == nil || c.Name() == DefaultCodec.Name() {
+		return ""
+	}
+	return "/" + c.Name()
+}
 
-	// 序列化 TestProto 字段
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string                            { return "binary" }
+func (binaryCodec) Encode(ts *TestStruct) ([]byte, error)   { return SerializeTestStruct(ts) }
+func (binaryCodec) Decode(data []byte) (*TestStruct, error) { return DeserializeTestStruct(data) }
+func (binaryCodec) VerifyMode() VerifyMode                  { return VerifyFlat }
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string { return "protobuf" }
+
+func (protobufCodec) Encode(ts *TestStruct) ([]byte, error) {
+	if ts == nil || ts.TestProto == nil {
+		return nil, nil
+	}
 	return ts.TestProto.Marshal()
 }
 
-// DeserializeTestStruct 从字节数组反序列化为 TestStruct
-// 使用 protobuf 反序列化 TestProto 字段，并重构 TestStruct
-// 注意：非 protobuf 字段会使用默认值，这适合 protobuf 性能基准测试
+func (protobufCodec) Decode(data []byte) (*TestStruct, error) {
+	pb := &TestPB{}
+	if err := pb.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return &TestStruct{TestProto: pb}, nil
+}
+
+func (protobufCodec) VerifyMode() VerifyMode { return VerifyProto }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+
+func (gobCodec) Encode(ts *TestStruct) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ts); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte) (*TestStruct, error) {
+	ts := &TestStruct{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (gobCodec) VerifyMode() VerifyMode { return VerifyFull }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                          { return "json" }
+func (jsonCodec) Encode(ts *TestStruct) ([]byte, error) { return json.Marshal(ts) }
+
+func (jsonCodec) Decode(data []byte) (*TestStruct, error) {
+	ts := &TestStruct{}
+	if err := json.Unmarshal(data, ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (jsonCodec) VerifyMode() VerifyMode { return VerifyFull }
+
+// compressor 是 compress 包里一种格式，writer 和 reader 都放在 sync.Pool 里复用，
+// flate 的 writer 每个要分配几百 KB
+type compressor struct {
+	name      string
+	newWriter func(w io.Writer) resetWriter
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// resetReader 是 flate.Resetter 和 zlib.Resetter
+type resetReader interface {
+	io.ReadCloser
+	Reset(r io.Reader, dict []byte) error
+}
+
+// 压缩都用 BestSpeed，cache 更在意写入的延迟
+var compressors = []compressor{
+	{
+		name: "flate",
+		newWriter: func(w io.Writer) resetWriter {
+			fw, _ := flate.NewWriter(w, flate.BestSpeed)
+			return fw
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	},
+	{
+		name: "zlib",
+		newWriter: func(w io.Writer) resetWriter {
+			zw, _ := zlib.NewWriterLevel(w, zlib.BestSpeed)
+			return zw
+		},
+		newReader: zlib.NewReader,
+	},
+}
+
+func (c compressor) wrap(codec Codec) Codec {
+	return &compressedCodec{Codec: codec, compressor: c}
+}
+
+// compressedCodec 压缩另一个 Codec 的编码结果
+type compressedCodec struct {
+	Codec
+	compressor compressor
+	writers    sync.Pool
+	readers    sync.Pool
+}
+
+func (c *compressedCodec) Name() string {
+	return c.Codec.Name() + "+" + c.compressor.name
+}
+
+func (c *compressedCodec) Encode(ts *TestStruct) ([]byte, error) {
+	data, err := c.Codec.Encode(ts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Grow(len(data)/2 + 64)
+	w, ok := c.writers.Get().(resetWriter)
+	if ok {
+		w.Reset(&buf)
+	} else {
+		w = c.compressor.newWriter(&buf)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *compressedCodec) Decode(data []byte) (*TestStruct, error) {
+	src := bytes.NewReader(data)
+	r, ok := c.readers.Get().(resetReader)
+	if ok {
+		if err := r.Reset(src, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		rc, err := c.compressor.newReader(src)
+		if err != nil {
+			return nil, err
+		}
+		r = rc.(resetReader)
+	}
+	defer c.readers.Put(r)
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Decode(raw)
+}
+
+// SerializeTestStruct 将整个 TestStruct 编码为字节数组
+// 保存的内容和 heyicache 一致：子结构体、子结构体指针、slice、Flag 和 TestProto 都会保存，
+// 带 heyicache:"skip" tag 的字段和 map 不保存，读出来是零值，这样字节型的 cache 和 heyicache 对比的是同样的数据
+// 编码格式：整数用 uvarint，string/[]byte/slice 先写 uvarint 长度，指针先写一个字节表示是否为 nil，float32 用 4 字节小端
+func SerializeTestStruct(ts *TestStruct) ([]byte, error) {
+	if ts == nil {
+		return nil, nil
+	}
+
+	// 先算出长度，只分配一次
+	counter := binWriter{}
+	counter.testStruct(ts)
+	w := binWriter{buf: make([]byte, 0, counter.n)}
+	w.testStruct(ts)
+	return w.buf, nil
+}
+
+// DeserializeTestStruct 从 SerializeTestStruct 编码的字节数组解码出 TestStruct
+// 所有 string 共用一次 string(data) 的内存，data 之后可以被 cache 复用
 func DeserializeTestStruct(data []byte) (*TestStruct, error) {
 	if len(data) == 0 {
 		return nil, nil
 	}
 
-	testProto := &TestPB{}
-	if err := testProto.Unmarshal(data); err != nil {
-		return nil, err
+	r := binReader{data: data, str: string(data)}
+	ts := r.testStruct()
+	if r.err == nil && r.off != len(data) {
+		r.err = errTrailingBytes
+	}
+	if r.err != nil {
+		return nil, r.err
 	}
+	return ts, nil
+}
 
-	// 从 protobuf 数据重构 TestStruct，这样可以保持数据一致性
-	// 同时专注于测试 protobuf 序列化性能
+var (
+	errShortBuffer   = errors.New("serialize: unexpected end of data")
+	errTrailingBytes = errors.New("serialize: trailing bytes after value")
+)
 
-	return &TestStruct{
-		Id:       testProto.Id % uint64(maxNum),
-		TestName: testProto.TestString,
-		TestChild: TestStructChild{
-			Id:       testProto.TestChild.Id % uint64(maxNum),
-			TestName: testProto.TestChild.TestString,
-		},
-		TestProto: testProto,
-	}, nil
+// binWriter buf 为 nil 时只统计长度
+type binWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *binWriter) uvarint(v uint64) {
+	if w.buf == nil {
+		w.n += uvarintLen(v)
+		return
+	}
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *binWriter) byte(v byte) {
+	if w.buf == nil {
+		w.n++
+		return
+	}
+	w.buf = append(w.buf, v)
+}
+
+func (w *binWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	if w.buf == nil {
+		w.n += len(s)
+		return
+	}
+	w.buf = append(w.buf, s...)
+}
+
+func (w *binWriter) float32(v float32) {
+	if w.buf == nil {
+		w.n += 4
+		return
+	}
+	w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(v))
+}
+
+// present 写入指针是否为 nil
+func (w *binWriter) present(notNil bool) bool {
+	if notNil {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+	return notNil
+}
+
+func (w *binWriter) testStruct(ts *TestStruct) {
+	w.uvarint(ts.Id)
+	w.string(ts.TestName)
+	w.string(ts.TestSkip)
+	w.testStructChild(&ts.TestChild)
+	w.uvarint(uint64(len(ts.TestChildren)))
+	for i := range ts.TestChildren {
+		w.testStructChild(&ts.TestChildren[i])
+	}
+	if w.present(ts.TestChildPtr != nil) {
+		w.testStructChild(ts.TestChildPtr)
+	}
+	w.uvarint(uint64(len(ts.TestChildrenPtr)))
+	for _, c := range ts.TestChildrenPtr {
+		if w.present(c != nil) {
+			w.testStructChild(c)
+		}
+	}
+	if w.present(ts.TestProto != nil) {
+		w.testPB(ts.TestProto)
+	}
+	w.byte(ts.Flag)
+}
+
+// testStructChild 不保存带 skip tag 的 TestSkip
+func (w *binWriter) testStructChild(c *TestStructChild) {
+	w.uvarint(c.Id)
+	w.string(c.TestName)
+}
+
+// testPB 不保存 TestMap
+func (w *binWriter) testPB(pb *TestPB) {
+	w.pbFields(pb.Id, pb.TestString, pb.TestStrings, pb.TestUint64S, pb.TestBytes, pb.TestFloats)
+	if w.present(pb.TestChild != nil) {
+		w.testPBChild(pb.TestChild)
+	}
+	w.uvarint(uint64(len(pb.TestChildren)))
+	for _, c := range pb.TestChildren {
+		if w.present(c != nil) {
+			w.testPBChild(c)
+		}
+	}
+}
+
+func (w *binWriter) testPBChild(c *TestPBChild) {
+	w.pbFields(c.Id, c.TestString, c.TestStrings, c.TestUint64S, c.TestBytes, c.TestFloats)
+}
+
+// pbFields 写入 TestPB 和 TestPBChild 共有的字段
+func (w *binWriter) pbFields(id uint64, s string, strs []string, uints []uint64, bs []byte, floats []float32) {
+	w.uvarint(id)
+	w.string(s)
+	w.uvarint(uint64(len(strs)))
+	for _, s := range strs {
+		w.string(s)
+	}
+	w.uvarint(uint64(len(uints)))
+	for _, v := range uints {
+		w.uvarint(v)
+	}
+	w.string(unsafe.String(unsafe.SliceData(bs), len(bs)))
+	w.uvarint(uint64(len(floats)))
+	for _, v := range floats {
+		w.float32(v)
+	}
+}
+
+func uvarintLen(v uint64) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// binReader 出错后所有读取都返回零值，最后检查 err
+type binReader struct {
+	data []byte
+	str  string // data 的拷贝，string 字段都是它的子串
+	off  int
+	err  error
+}
+
+func (r *binReader) fail() {
+	if r.err == nil {
+		r.err = errShortBuffer
+	}
+	r.off = len(r.data)
+}
+
+func (r *binReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.off += n
+	return v
+}
+
+func (r *binReader) byte() byte {
+	if r.off >= len(r.data) {
+		r.fail()
+		return 0
+	}
+	r.off++
+	return r.data[r.off-1]
+}
+
+// length 读取一个长度，每个元素至少占 minSize 字节，超出剩余数据的长度视为损坏
+func (r *binReader) length(minSize int) int {
+	n := r.uvarint()
+	if n > uint64((len(r.data)-r.off)/minSize) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binReader) string() string {
+	n := r.length(1)
+	s := r.str[r.off : r.off+n]
+	r.off += n
+	return s
+}
+
+func (r *binReader) bytes() []byte {
+	n := r.length(1)
+	if n == 0 {
+		return nil
+	}
+	bs := make([]byte, n)
+	copy(bs, r.data[r.off:])
+	r.off += n
+	return bs
+}
+
+func (r *binReader) float32() float32 {
+	if len(r.data)-r.off < 4 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.off:])
+	r.off += 4
+	return math.Float32frombits(v)
+}
+
+func (r *binReader) present() bool {
+	return r.byte() != 0
+}
+
+func (r *binReader) testStruct() *TestStruct {
+	ts := &TestStruct{
+		Id:       r.uvarint(),
+		TestName: r.string(),
+		TestSkip: r.string(),
+	}
+	r.testStructChild(&ts.TestChild)
+	if n := r.length(2); n > 0 {
+		ts.TestChildren = make([]TestStructChild, n)
+		for i := range ts.TestChildren {
+			r.testStructChild(&ts.TestChildren[i])
+		}
+	}
+	if r.present() {
+		ts.TestChildPtr = &TestStructChild{}
+		r.testStructChild(ts.TestChildPtr)
+	}
+	if n := r.length(1); n > 0 {
+		ts.TestChildrenPtr = make([]*TestStructChild, n)
+		for i := range ts.TestChildrenPtr {
+			if r.present() {
+				ts.TestChildrenPtr[i] = &TestStructChild{}
+				r.testStructChild(ts.TestChildrenPtr[i])
+			}
+		}
+	}
+	if r.present() {
+		ts.TestProto = r.testPB()
+	}
+	ts.Flag = r.byte()
+	return ts
+}
+
+func (r *binReader) testStructChild(c *TestStructChild) {
+	c.Id = r.uvarint()
+	c.TestName = r.string()
+}
+
+func (r *binReader) testPB() *TestPB {
+	pb := &TestPB{}
+	pb.Id, pb.TestString, pb.TestStrings, pb.TestUint64S, pb.TestBytes, pb.TestFloats = r.pbFields()
+	if r.present() {
+		pb.TestChild = r.testPBChild()
+	}
+	if n := r.length(1); n > 0 {
+		pb.TestChildren = make([]*TestPBChild, n)
+		for i := range pb.TestChildren {
+			if r.present() {
+				pb.TestChildren[i] = r.testPBChild()
+			}
+		}
+	}
+	return pb
+}
+
+func (r *binReader) testPBChild() *TestPBChild {
+	c := &TestPBChild{}
+	c.Id, c.TestString, c.TestStrings, c.TestUint64S, c.TestBytes, c.TestFloats = r.pbFields()
+	return c
+}
+
+func (r *binReader) pbFields() (id uint64, s string, strs []string, uints []uint64, bs []byte, floats []float32) {
+	id = r.uvarint()
+	s = r.string()
+	if n := r.length(1); n > 0 {
+		strs = make([]string, n)
+		for i := range strs {
+			strs[i] = r.string()
+		}
+	}
+	if n := r.length(1); n > 0 {
+		uints = make([]uint64, n)
+		for i := range uints {
+			uints[i] = r.uvarint()
+		}
+	}
+	bs = r.bytes()
+	if n := r.length(4); n > 0 {
+		floats = make([]float32, n)
+		for i := range floats {
+			floats[i] = r.float32()
+		}
+	}
+	return
 }
 
 // StringToByte 高性能强转string->[]byte
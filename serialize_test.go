@@ -0,0 +1,86 @@
+package benchmark
+
+import "testing"
+
+func TestSerializeTestStruct(t *testing.T) {
+	values := []*TestStruct{{}, {TestChildrenPtr: []*TestStructChild{nil, {Id: 1}}, TestProto: &TestPB{}}}
+	for _, name := range ValueProfileNames() {
+		for id := 0; id < 20; id++ {
+			_, v := newTestStruct(ValueProfiles[name], id)
+			values = append(values, v)
+		}
+	}
+	for _, v := range values {
+		data, err := SerializeTestStruct(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DeserializeTestStruct(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mismatches := VerifyTestStruct(got, v, VerifyFlat); len(mismatches) > 0 {
+			t.Fatalf("record %d: %v", v.Id, mismatches)
+		}
+		if got.TestChildPtr != nil && got.TestChildPtr.TestSkip != "" {
+			t.Fatalf("record %d: skip-tagged field stored", v.Id)
+		}
+		// every truncation is an error, not a panic
+		for n := 1; n < len(data); n++ {
+			if _, err := DeserializeTestStruct(data[:n]); err == nil {
+				t.Fatalf("record %d: no error on %d of %d bytes", v.Id, n, len(data))
+			}
+		}
+	}
+}
+
+func BenchmarkSerializeTestStruct(b *testing.B) {
+	_, v := NewTestStruct(7)
+	data, _ := SerializeTestStruct(v)
+	b.Run("encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = SerializeTestStruct(v)
+		}
+	})
+	b.Run("decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = DeserializeTestStruct(data)
+		}
+	})
+	b.ReportMetric(float64(len(data)), "bytes")
+}
+
+func TestCodecs(t *testing.T) {
+	names := append(CodecNames(), "gob+zlib", "protobuf+flate")
+	for _, name := range names {
+		codec, err := ParseCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec.Name() != name {
+			t.Errorf("%s is named %s", name, codec.Name())
+		}
+		// twice, the second time with the pooled compressors
+		for id := 0; id < 2; id++ {
+			_, v := NewTestStruct(id)
+			data, err := codec.Encode(v)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got, err := codec.Decode(data)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if mismatches := VerifyTestStruct(got, v, codec.VerifyMode()); len(mismatches) > 0 {
+				t.Fatalf("%s (%s): %v", name, codec.VerifyMode(), mismatches)
+			}
+		}
+	}
+	for _, name := range []string{"xml", "binary+lz4"} {
+		if _, err := ParseCodec(name); err == nil {
+			t.Errorf("%s parsed", name)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SweepPoint is the result of one cache at one concurrency level
+type SweepPoint struct {
+	Cache      string  `json:"cache"`
+	Goroutines int     `json:"goroutines"`
+	Throughput float64 `json:"ops_per_sec"`
+	P50        int64   `json:"p50_ns"`
+	P99        int64   `json:"p99_ns"`
+	HitRate    float64 `json:"hit_pct"`
+}
+
+type SweepPoints []SweepPoint
+
+func (points SweepPoints) csvHeader() []string {
+	return []string{"cache", "goroutines", "ops_per_sec", "p50_ns", "p99_ns", "hit_pct"}
+}
+
+func (points SweepPoints) csvRows() [][]string {
+	rows := make([][]string, 0, len(points))
+	for _, p := range points {
+		rows = append(rows, []string{
+			p.Cache,
+			strconv.Itoa(p.Goroutines),
+			formatFloat(p.Throughput, 0),
+			strconv.FormatInt(p.P50, 10),
+			strconv.FormatInt(p.P99, 10),
+			formatFloat(p.HitRate, 2),
+		})
+	}
+	return rows
+}
+
+// SweepSteps returns 1, 2, 4, ... up to factor*GOMAXPROCS goroutines, the
+// last step is the maximum even when it's not a power of two
+func SweepSteps(factor int) []int {
+	limit := max(1, factor*runtime.GOMAXPROCS(0))
+	var steps []int
+	for g := 1; g < limit; g *= 2 {
+		steps = append(steps, g)
+	}
+	return append(steps, limit)
+}
+
+// ConcurrencySweep runs wl against a fresh instance of every cache at every
+// step of goroutines, each step runs for d
+func ConcurrencySweep(factories []AdapterFactory, wl Workload, steps []int, d time.Duration) (SweepPoints, error) {
+	wl.Latency = true
+	var points SweepPoints
+	for _, factory := range factories {
+		for _, g := range steps {
+			wl.Goroutines = g
+			cache, err := factory.New()
+			if err != nil {
+				return nil, fmt.Errorf("create %s: %v", factory.Name, err)
+			}
+			result, err := runFor(cache, wl, d)
+			closeCache(cache)
+			if err != nil {
+				return nil, err
+			}
+			ops := result.Latency.Ops()
+			points = append(points, SweepPoint{
+				Cache:      factory.Name,
+				Goroutines: g,
+				Throughput: result.Throughput(),
+				P50:        ops.Quantile(0.5),
+				P99:        ops.Quantile(0.99),
+				HitRate:    result.HitRate(),
+			})
+		}
+	}
+	return points, nil
+}
+
+// CapacityPoint is the result of one cache at one capacity
+type CapacityPoint struct {
+	Cache         string  `json:"cache"`
+	CapacityPct   float64 `json:"capacity_pct"`   // requested capacity relative to the working set
+	Capacity      int64   `json:"capacity_bytes"` // capacity the cache really got
+	WorkingSet    int64   `json:"working_set_bytes"`
+	HitRate       float64 `json:"hit_pct"`
+	Evictions     int64   `json:"evictions"`   // -1 when the cache doesn't count them
+	Evacuations   int64   `json:"evacuations"` // dropped or moved, -1 when the cache doesn't count them
+	WriteFailRate float64 `json:"write_fail_pct"`
+	Throughput    float64 `json:"ops_per_sec"`
+}
+
+type CapacityPoints []CapacityPoint
+
+func (points CapacityPoints) csvHeader() []string {
+	return []string{"cache", "capacity_pct", "capacity_bytes", "working_set_bytes", "hit_pct", "miss_pct", "evictions", "evacuations", "write_fail_pct", "ops_per_sec"}
+}
+
+func (points CapacityPoints) csvRows() [][]string {
+	rows := make([][]string, 0, len(points))
+	for _, p := range points {
+		rows = append(rows, []string{
+			p.Cache,
+			formatFloat(p.CapacityPct, 0),
+			strconv.FormatInt(p.Capacity, 10),
+			strconv.FormatInt(p.WorkingSet, 10),
+			formatFloat(p.HitRate, 2),
+			formatFloat(100-p.HitRate, 2),
+			strconv.FormatInt(p.Evictions, 10),
+			strconv.FormatInt(p.Evacuations, 10),
+			formatFloat(p.WriteFailRate, 2),
+			formatFloat(p.Throughput, 0),
+		})
+	}
+	return rows
+}
+
+// CapacityPercents is the default range of the capacity sweep
+var CapacityPercents = []float64{10, 25, 50, 75, 100, 125, 150, 200}
+
+// CapacityWorkload loads every record then reads with cache-aside fills, so a
+// cache smaller than the working set keeps evicting and the hit rate traces
+// the miss ratio curve
+var CapacityWorkload = DefaultWorkload.WithMix("capacity", 100, 0, 0, 0, 0)
+
+func init() {
+	CapacityWorkload.Records = 100000
+	CapacityWorkload.FillOnMiss = true
+}
+
+// WorkingSetBytes is the size of all records of a workload, counted as the
+// flat size heyicache stores plus the key
+func WorkingSetBytes(records int) int64 {
+	var total int64
+	for id := 0; id < records; id++ {
+		k, v := NewTestStruct(id)
+		total += int64(len(k)) + int64(HeyiCacheFnTestStructIfc_.Size(v, true))
+	}
+	return total
+}
+
+// CapacitySweep runs wl against every cache sized to every percent of the
+// working set, each step runs for d. The percents below the MinCapacity of a
+// cache are skipped, it would run with more than asked
+func CapacitySweep(factories []SizedAdapterFactory, wl Workload, percents []float64, d time.Duration) (CapacityPoints, error) {
+	workingSet := WorkingSetBytes(wl.Records)
+	var points CapacityPoints
+	for _, factory := range factories {
+		for _, pct := range percents {
+			capacity := int64(float64(workingSet) * pct / 100)
+			if capacity < MinCapacity[factory.Name] {
+				continue
+			}
+			point, err := capacityPoint(factory, wl, capacity, d)
+			if err != nil {
+				return nil, err
+			}
+			point.CapacityPct = pct
+			point.WorkingSet = workingSet
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// capacityPoint runs wl for d against a fresh cache of the given capacity,
+// the evictions and evacuations are counted over the run only, not the preload
+func capacityPoint(factory SizedAdapterFactory, wl Workload, capacity int64, d time.Duration) (CapacityPoint, error) {
+	cache, err := factory.New(capacity)
+	if err != nil {
+		return CapacityPoint{}, fmt.Errorf("create %s with %d bytes: %v", factory.Name, capacity, err)
+	}
+	defer closeCache(cache)
+	if err := prepare(cache, &wl); err != nil {
+		return CapacityPoint{}, err
+	}
+	loadEvictions, loadEvacuations := drops(cache)
+	runtime.GC()
+	result := RunWorkloadFor(cache, &wl, d)
+	evictions, evacuations := drops(cache)
+	if evictions >= 0 {
+		evictions -= loadEvictions
+	}
+	if evacuations >= 0 {
+		evacuations -= loadEvacuations
+	}
+	if c, ok := cache.(CapacityReporter); ok {
+		capacity = c.Capacity()
+	}
+	return CapacityPoint{
+		Cache:         factory.Name,
+		Capacity:      capacity,
+		HitRate:       result.HitRate(),
+		Evictions:     evictions,
+		Evacuations:   evacuations,
+		WriteFailRate: rate(result.WriteFail, result.WriteSuccess+result.WriteFail),
+		Throughput:    result.Throughput(),
+	}, nil
+}
+
+// drops returns the evictions and evacuations of cache so far, -1 for the
+// ones it doesn't count
+func drops(cache CacheAdapter) (evictions, evacuations int64) {
+	evictions, evacuations = -1, -1
+	if e, ok := cache.(EvictionCounter); ok {
+		evictions = e.Evictions()
+	}
+	if e, ok := cache.(EvacuationCounter); ok {
+		evacuations = e.Evacuations()
+	}
+	return evictions, evacuations
+}
+
+// prepare checks that cache can run wl then loads the records
+func prepare(cache CacheAdapter, wl *Workload) error {
+	if err := wl.Validate(); err != nil {
+		return err
+	}
+	if err := checkCapabilities(cache, wl); err != nil {
+		return err
+	}
+	if wl.Preload {
+		LoadRecords(cache, wl)
+	}
+	return nil
+}
+
+// runFor loads the records then runs wl against cache for d
+func runFor(cache CacheAdapter, wl Workload, d time.Duration) (*BenchResult, error) {
+	if err := prepare(cache, &wl); err != nil {
+		return nil, err
+	}
+	runtime.GC()
+	return RunWorkloadFor(cache, &wl, d), nil
+}
+
+// csvTable is implemented by the result slices that can be written as CSV
+type csvTable interface {
+	csvHeader() []string
+	csvRows() [][]string
+}
+
+// SaveTable writes t to path as CSV when it ends with .csv, JSON otherwise
+func SaveTable(path string, t csvTable) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	format := "json"
+	if strings.HasSuffix(path, ".csv") {
+		format = "csv"
+	}
+	if err := WriteTable(f, format, t); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// WriteTable writes t to w as "csv" or "json"
+func WriteTable(w io.Writer, format string, t csvTable) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write(t.csvHeader())
+		_ = cw.WriteAll(t.csvRows())
+		return cw.Error()
+	case "json":
+		return writeJSON(w, t)
+	}
+	return fmt.Errorf("unknown table format %q", format)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatFloat(v float64, prec int) string {
+	return strconv.FormatFloat(v, 'f', prec, 64)
+}
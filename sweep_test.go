@@ -0,0 +1,64 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCapacitySweepMinCapacity checks heyicache isn't run below the capacity
+// it can be built with and freecache reports evacuations, not evictions
+func TestCapacitySweepMinCapacity(t *testing.T) {
+	wl := CapacityWorkload
+	wl.Records = 1000
+	var factories []SizedAdapterFactory
+	for _, f := range SizedAdapters {
+		if f.Name == "HeyiCache" || f.Name == "FreeCache" {
+			factories = append(factories, f)
+		}
+	}
+	// about 1.5MB and 75MB
+	points, err := CapacitySweep(factories, wl, []float64{100, 5000}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var heyi, free int
+	for _, p := range points {
+		switch p.Cache {
+		case "HeyiCache":
+			heyi++
+			if p.Capacity < MinCapacity["HeyiCache"] || p.CapacityPct != 5000 {
+				t.Errorf("HeyiCache run at %.0f%%: %d bytes", p.CapacityPct, p.Capacity)
+			}
+		case "FreeCache":
+			free++
+			if p.Evictions != -1 || p.Evacuations < 0 {
+				t.Errorf("FreeCache: %d evictions, %d evacuations", p.Evictions, p.Evacuations)
+			}
+		}
+	}
+	if heyi != 1 || free != 2 {
+		t.Fatalf("%d HeyiCache and %d FreeCache points", heyi, free)
+	}
+}
+
+// TestCapacitySweepRunOnly checks the evictions of the preload aren't counted:
+// a run that only reads the records without filling its misses evicts nothing
+func TestCapacitySweepRunOnly(t *testing.T) {
+	wl := CapacityWorkload.WithMix("read", 100, 0, 0, 0, 0)
+	wl.Records = 1000
+	wl.Goroutines = 2
+	wl.FillOnMiss = false
+	var factories []SizedAdapterFactory
+	for _, f := range SizedAdapters {
+		if f.Name == "Map" {
+			factories = append(factories, f)
+		}
+	}
+	points, err := CapacitySweep(factories, wl, []float64{25}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].Evictions != 0 {
+		t.Fatalf("unexpected points %+v", points)
+	}
+}
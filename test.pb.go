@@ -1,7 +1,7 @@
 // Code generated by protoc-gen-gogo. DO NOT EDIT.
 // source: test.proto
 
-package main
+package benchmark
 
 import (
 	encoding_binary "encoding/binary"
@@ -233,29 +233,32 @@ func init() {
 func init() { proto.RegisterFile("test.proto", fileDescriptor_c161fcfdc0c3ff1e) }
 
 var fileDescriptor_c161fcfdc0c3ff1e = []byte{
-	// 349 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x53, 0x41, 0x4f, 0xc2, 0x30,
-	0x14, 0xa6, 0xeb, 0x00, 0xf7, 0x36, 0x8d, 0x36, 0x1e, 0xaa, 0x89, 0xb5, 0x72, 0xea, 0x89, 0x18,
-	0x24, 0x44, 0x39, 0x62, 0xf4, 0x66, 0x62, 0xa6, 0x9e, 0xc9, 0x70, 0x55, 0x17, 0x61, 0x90, 0xb5,
-	0x98, 0xf0, 0x2f, 0xbc, 0xfb, 0x53, 0xfc, 0x03, 0x1e, 0x39, 0x7a, 0x34, 0xf0, 0x47, 0xcc, 0x5a,
-	0x02, 0x4b, 0xf0, 0x66, 0x8c, 0xa7, 0xb5, 0xdf, 0xbe, 0xef, 0x7b, 0xef, 0x7b, 0x2f, 0x05, 0xd0,
-	0x52, 0xe9, 0xfa, 0x28, 0x1b, 0xea, 0x21, 0x71, 0x07, 0x51, 0x92, 0xd6, 0xde, 0x30, 0x54, 0x6e,
-	0xa5, 0xd2, 0xd7, 0x1d, 0xb2, 0x05, 0x4e, 0x12, 0x53, 0xc4, 0x91, 0x70, 0x43, 0x27, 0x89, 0xc9,
-	0x21, 0xf8, 0x39, 0xbd, 0xab, 0x74, 0x96, 0xa4, 0x8f, 0xd4, 0xe1, 0x48, 0x78, 0xa1, 0x71, 0xb8,
-	0x31, 0x08, 0x39, 0x82, 0xa0, 0x40, 0x50, 0x14, 0x73, 0x2c, 0xbc, 0xd0, 0x5f, 0x31, 0x14, 0x69,
-	0xc2, 0x86, 0xa1, 0x0c, 0xa2, 0x11, 0x75, 0x39, 0x16, 0x7e, 0x63, 0xaf, 0x9e, 0xd7, 0xad, 0xdb,
-	0x9a, 0xe6, 0x73, 0x15, 0x8d, 0x2e, 0x52, 0x9d, 0x4d, 0xc2, 0xaa, 0xb6, 0xb7, 0xa5, 0xf1, 0x38,
-	0x49, 0x75, 0xab, 0xa9, 0x68, 0x99, 0x63, 0xe1, 0x5a, 0xe3, 0x3b, 0x0b, 0x91, 0x03, 0x9b, 0xa5,
-	0xdb, 0x9b, 0x68, 0xa9, 0x68, 0x85, 0x23, 0x11, 0x84, 0x5e, 0x8e, 0x74, 0x72, 0x60, 0xd9, 0xfb,
-	0x43, 0x7f, 0x18, 0x69, 0x45, 0xab, 0x1c, 0x0b, 0xc7, 0xf6, 0x7e, 0x69, 0x10, 0x72, 0xbc, 0xd0,
-	0xdf, 0x3f, 0x25, 0xfd, 0x98, 0xc6, 0x1c, 0x09, 0xbf, 0xb1, 0x53, 0x6c, 0xed, 0x3c, 0xff, 0x61,
-	0x2d, 0xcd, 0x91, 0xb4, 0x60, 0x73, 0xa5, 0xc8, 0x64, 0x4a, 0xa5, 0xc9, 0xf3, 0x83, 0x28, 0x58,
-	0x8a, 0x32, 0x99, 0xee, 0xb7, 0x21, 0x28, 0xa6, 0x24, 0xdb, 0x80, 0x9f, 0xe5, 0xc4, 0xcc, 0xd9,
-	0x0b, 0xf3, 0x23, 0xd9, 0x85, 0xf2, 0x4b, 0xd4, 0x1f, 0xcb, 0xc5, 0x88, 0xed, 0xa5, 0xed, 0x9c,
-	0xa2, 0xda, 0xbb, 0x03, 0x7e, 0xc1, 0xf9, 0x4f, 0x56, 0x74, 0xb6, 0xb6, 0x22, 0xb6, 0x16, 0xe9,
-	0xdf, 0xf6, 0xf4, 0x9b, 0xe9, 0x75, 0xe8, 0xc7, 0x8c, 0xa1, 0xe9, 0x8c, 0xa1, 0xaf, 0x19, 0x43,
-	0xaf, 0x73, 0x56, 0x9a, 0xce, 0x59, 0xe9, 0x73, 0xce, 0x4a, 0xbd, 0x8a, 0x79, 0x02, 0x27, 0xdf,
-	0x01, 0x00, 0x00, 0xff, 0xff, 0xa4, 0x1b, 0x69, 0x29, 0x10, 0x03, 0x00, 0x00,
+	// 390 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x53, 0x3d, 0x8f, 0xd3, 0x30,
+	0x18, 0xae, 0xe3, 0x5c, 0x8f, 0x38, 0x01, 0x81, 0xc5, 0x60, 0x90, 0x08, 0xe6, 0x26, 0x2f, 0xe4,
+	0xca, 0xf5, 0x74, 0x82, 0x63, 0x2b, 0x82, 0xed, 0x24, 0x14, 0x60, 0x61, 0x39, 0x39, 0x89, 0xb9,
+	0x58, 0xcd, 0x47, 0x15, 0x3b, 0x48, 0xf9, 0x17, 0xec, 0xfc, 0x14, 0xfe, 0x00, 0x63, 0x47, 0x46,
+	0xd4, 0xfe, 0x11, 0x14, 0xbb, 0x4a, 0x23, 0x95, 0x0d, 0xa1, 0x9b, 0xf2, 0xbe, 0x4f, 0x9e, 0xe7,
+	0x79, 0xbf, 0x64, 0x84, 0xb4, 0x50, 0x3a, 0x5a, 0x35, 0xb5, 0xae, 0xb1, 0x5b, 0x72, 0x59, 0x9d,
+	0x7c, 0x87, 0x68, 0xfa, 0x51, 0x28, 0xfd, 0x7e, 0x81, 0xef, 0x21, 0x47, 0x66, 0x04, 0x50, 0xc0,
+	0xdc, 0xd8, 0x91, 0x19, 0x7e, 0x8a, 0xfc, 0x9e, 0x7e, 0xad, 0x74, 0x23, 0xab, 0x1b, 0xe2, 0x50,
+	0xc0, 0xbc, 0xd8, 0x38, 0x7c, 0x30, 0x08, 0x7e, 0x86, 0x82, 0x11, 0x41, 0x11, 0x48, 0x21, 0xf3,
+	0x62, 0x7f, 0xcf, 0x50, 0xf8, 0x1c, 0xdd, 0x31, 0x94, 0x92, 0xaf, 0x88, 0x4b, 0x21, 0xf3, 0xcf,
+	0x1e, 0x45, 0x7d, 0xdd, 0xc8, 0xd6, 0x34, 0x9f, 0x2b, 0xbe, 0x7a, 0x5b, 0xe9, 0xa6, 0x8b, 0x8f,
+	0xb5, 0xcd, 0x06, 0xe3, 0x56, 0x56, 0xfa, 0xe2, 0x5c, 0x91, 0x23, 0x0a, 0x99, 0x6b, 0x8d, 0x3f,
+	0x59, 0x08, 0x3f, 0xb1, 0xb3, 0x5c, 0x27, 0x9d, 0x16, 0x8a, 0x4c, 0x29, 0x60, 0x41, 0xec, 0xf5,
+	0xc8, 0xa2, 0x07, 0x86, 0xde, 0xbf, 0x14, 0x35, 0xd7, 0x8a, 0x1c, 0x53, 0xc8, 0x1c, 0xdb, 0xfb,
+	0x3b, 0x83, 0xe0, 0xd9, 0x4e, 0x9f, 0xe6, 0xb2, 0xc8, 0x48, 0x46, 0x01, 0xf3, 0xcf, 0x1e, 0x8c,
+	0x5b, 0x7b, 0xd3, 0xff, 0xb0, 0x96, 0x26, 0xc4, 0x17, 0xe8, 0xee, 0x5e, 0xd1, 0x88, 0x8a, 0x08,
+	0x0a, 0xff, 0x2e, 0x0a, 0x06, 0x51, 0x23, 0xaa, 0xc7, 0x97, 0x28, 0x18, 0x4f, 0x89, 0xef, 0x23,
+	0xb8, 0x14, 0x9d, 0xd9, 0xb3, 0x17, 0xf7, 0x21, 0x7e, 0x88, 0x8e, 0xbe, 0xf2, 0xa2, 0x15, 0xbb,
+	0x15, 0xdb, 0xe4, 0xd2, 0x79, 0x09, 0x4e, 0x7e, 0x38, 0xc8, 0x1f, 0x39, 0xff, 0x97, 0x13, 0xbd,
+	0x3a, 0x38, 0x51, 0x78, 0x30, 0xd2, 0xad, 0xdd, 0xe9, 0x5f, 0xb6, 0xb7, 0xb8, 0xfa, 0x3c, 0xbf,
+	0x91, 0x3a, 0x6f, 0x93, 0x28, 0xad, 0xcb, 0xd3, 0xae, 0xe5, 0x99, 0x2a, 0xe6, 0xb3, 0x17, 0xb3,
+	0xd3, 0x5c, 0x74, 0x32, 0xe5, 0x69, 0x2e, 0x9e, 0x27, 0xa2, 0x4a, 0xf3, 0x92, 0x37, 0xcb, 0xd7,
+	0x43, 0xf4, 0x73, 0x13, 0x82, 0xf5, 0x26, 0x04, 0xbf, 0x37, 0x21, 0xf8, 0xb6, 0x0d, 0x27, 0xeb,
+	0x6d, 0x38, 0xf9, 0xb5, 0x0d, 0x27, 0xc9, 0xd4, 0xbc, 0x9b, 0xf9, 0x9f, 0x01, 0x00, 0xef, 0xba,
+	0x58, 0x2e, 0x45, 0x03, 0x00, 0x00,
 }
 
 func (m *TestPB) Marshal() (dAtA []byte, err error) {
@@ -1,4 +1,4 @@
-package main
+package benchmark
 
 type TestStruct struct {
 	Id              uint64
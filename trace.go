@@ -0,0 +1,313 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TraceRecord is one operation of a recorded key stream. Keys are interned
+// into dense ids when the trace is loaded, so the replay builds its keys and
+// values the same way the synthetic workloads do
+type TraceRecord struct {
+	At        time.Duration // since the first record
+	Op        Op            // OpRead, OpWrite or OpDelete
+	ID        int
+	ValueSize int
+	TTL       time.Duration
+}
+
+type Trace struct {
+	Records []TraceRecord
+	Keys    int // distinct keys
+}
+
+// Duration is the time span the trace was recorded over
+func (t *Trace) Duration() time.Duration {
+	if len(t.Records) == 0 {
+		return 0
+	}
+	return t.Records[len(t.Records)-1].At
+}
+
+// hasOp reports whether any record of the trace is op
+func (t *Trace) hasOp(op Op) bool {
+	for i := range t.Records {
+		if t.Records[i].Op == op {
+			return true
+		}
+	}
+	return false
+}
+
+// traceBuilder interns keys and makes timestamps relative to the first record
+type traceBuilder struct {
+	trace Trace
+	ids   map[string]int
+	first time.Duration
+}
+
+func newTraceBuilder() *traceBuilder {
+	return &traceBuilder{ids: map[string]int{}, first: -1}
+}
+
+func (b *traceBuilder) add(at time.Duration, op Op, key string, size int, ttl time.Duration) {
+	id, ok := b.ids[key]
+	if !ok {
+		id = len(b.ids)
+		b.ids[key] = id
+	}
+	if b.first < 0 {
+		b.first = at
+	}
+	b.trace.Records = append(b.trace.Records, TraceRecord{
+		At:        max(at-b.first, 0),
+		Op:        op,
+		ID:        id,
+		ValueSize: size,
+		TTL:       ttl,
+	})
+}
+
+func (b *traceBuilder) done() *Trace {
+	b.trace.Keys = len(b.ids)
+	return &b.trace
+}
+
+const (
+	TraceJSONL         = "jsonl"
+	TraceBinary        = "binary"
+	TraceTwitter       = "twitter"        // twemcache production traces, github.com/twitter/cache-trace
+	TraceOracleGeneral = "oracle-general" // libCacheSim's oracleGeneral binary traces
+)
+
+// TraceFormats lists the formats LoadTrace understands
+var TraceFormats = []string{TraceJSONL, TraceBinary, TraceTwitter, TraceOracleGeneral}
+
+// LoadTrace reads the trace at path, an empty format is guessed from the
+// file extension
+func LoadTrace(path, format string) (*Trace, error) {
+	if format == "" {
+		switch filepath.Ext(path) {
+		case ".jsonl", ".json":
+			format = TraceJSONL
+		case ".csv":
+			format = TraceTwitter
+		case ".oracleGeneral":
+			format = TraceOracleGeneral
+		default:
+			format = TraceBinary
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<20)
+	switch format {
+	case TraceJSONL:
+		return ReadTraceJSONL(r)
+	case TraceBinary:
+		return ReadTraceBinary(r)
+	case TraceTwitter:
+		return ReadTwitterTrace(r)
+	case TraceOracleGeneral:
+		return ReadOracleGeneralTrace(r)
+	}
+	return nil, fmt.Errorf("unknown trace format %q, want one of %s", format, strings.Join(TraceFormats, ", "))
+}
+
+// jsonlRecord is one line of a JSONL trace: {"ts":1500,"op":"get","key":"user:1","size":512,"ttl":60}
+// ts is in nanoseconds and ttl in seconds
+type jsonlRecord struct {
+	TS   int64  `json:"ts"`
+	Op   string `json:"op"`
+	Key  string `json:"key"`
+	Size int    `json:"size,omitempty"`
+	TTL  int64  `json:"ttl,omitempty"`
+}
+
+func parseTraceOp(s string) (Op, error) {
+	switch strings.ToLower(s) {
+	case "get", "gets", "read":
+		return OpRead, nil
+	case "set", "add", "replace", "cas", "append", "prepend", "incr", "decr", "write":
+		return OpWrite, nil
+	case "delete", "del":
+		return OpDelete, nil
+	}
+	return 0, fmt.Errorf("unknown trace operation %q", s)
+}
+
+func traceOpName(op Op) string {
+	switch op {
+	case OpWrite:
+		return "set"
+	case OpDelete:
+		return "delete"
+	}
+	return "get"
+}
+
+func ReadTraceJSONL(r io.Reader) (*Trace, error) {
+	b := newTraceBuilder()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var rec jsonlRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		op, err := parseTraceOp(rec.Op)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		b.add(time.Duration(rec.TS), op, rec.Key, rec.Size, time.Duration(rec.TTL)*time.Second)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return b.done(), nil
+}
+
+func WriteTraceJSONL(w io.Writer, t *Trace) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, rec := range t.Records {
+		err := enc.Encode(jsonlRecord{
+			TS:   int64(rec.At),
+			Op:   traceOpName(rec.Op),
+			Key:  GetKey(rec.ID),
+			Size: rec.ValueSize,
+			TTL:  int64(rec.TTL / time.Second),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// the compact binary format is the magic followed by one record after the
+// other: uvarint time delta (ns), op byte, uvarint key id, uvarint value
+// size, uvarint ttl (s)
+const traceMagic = "HEYITRC1"
+
+func WriteTraceBinary(w io.Writer, t *Trace) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(traceMagic); err != nil {
+		return err
+	}
+	var buf [4*binary.MaxVarintLen64 + 1]byte
+	var last time.Duration
+	for _, rec := range t.Records {
+		n := binary.PutUvarint(buf[:], uint64(rec.At-last))
+		buf[n] = byte(rec.Op)
+		n++
+		n += binary.PutUvarint(buf[n:], uint64(rec.ID))
+		n += binary.PutUvarint(buf[n:], uint64(rec.ValueSize))
+		n += binary.PutUvarint(buf[n:], uint64(rec.TTL/time.Second))
+		if _, err := bw.Write(buf[:n]); err != nil {
+			return err
+		}
+		last = rec.At
+	}
+	return bw.Flush()
+}
+
+func ReadTraceBinary(r io.ByteReader) (*Trace, error) {
+	for i := 0; i < len(traceMagic); i++ {
+		c, err := r.ReadByte()
+		if err != nil || c != traceMagic[i] {
+			return nil, fmt.Errorf("not a %s trace", TraceBinary)
+		}
+	}
+	t := &Trace{}
+	var at time.Duration
+	for {
+		delta, err := binary.ReadUvarint(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if Op(op) != OpRead && Op(op) != OpWrite && Op(op) != OpDelete {
+			return nil, fmt.Errorf("record %d: unknown trace operation %d", len(t.Records), op)
+		}
+		var fields [3]uint64
+		for i := range fields {
+			if fields[i], err = binary.ReadUvarint(r); err != nil {
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+		at += time.Duration(delta)
+		rec := TraceRecord{
+			At:        at,
+			Op:        Op(op),
+			ID:        int(fields[0]),
+			ValueSize: int(fields[1]),
+			TTL:       time.Duration(fields[2]) * time.Second,
+		}
+		t.Keys = max(t.Keys, rec.ID+1)
+		t.Records = append(t.Records, rec)
+	}
+	return t, nil
+}
+
+// ReplayTrace replays t against ifc through the workload engine. Goroutines,
+// OpsPerRequest, Latency, FillOnMiss and AppLoad of wl apply, its operation
+// mix and key distribution don't. Records are spread over the goroutines by
+// key so the operations on one key keep their order. A write, or the fill of
+// a missed read, sets a value of the recorded size with the recorded ttl.
+// speed scales the recorded time (2 replays twice as fast), 0 replays as
+// fast as possible
+func ReplayTrace(ifc CacheAdapter, wl *Workload, t *Trace, speed float64) (*BenchResult, error) {
+	if wl.Goroutines <= 0 || wl.OpsPerRequest <= 0 {
+		return nil, fmt.Errorf("replay needs goroutines and ops per request > 0")
+	}
+	if t.hasOp(OpDelete) && !Capabilities(ifc).Has(CapDelete) {
+		return nil, fmt.Errorf("%s: the trace deletes but the cache can't", ifc.Name())
+	}
+	queues := make([][]TraceRecord, wl.Goroutines)
+	for _, rec := range t.Records {
+		g := rec.ID % wl.Goroutines
+		queues[g] = append(queues[g], rec)
+	}
+	result := runGoroutines(ifc, wl, func(gIdx int, w *worker, start time.Time) {
+		queue := queues[gIdx]
+		for i := 0; i < len(queue); {
+			scope := beginScope(ifc)
+			for j := 0; j < wl.OpsPerRequest && i < len(queue); j++ {
+				rec := &queue[i]
+				i++
+				if speed > 0 {
+					w.delay = waitUntil(start.Add(time.Duration(float64(rec.At) / speed)))
+				}
+				w.replaying = rec
+				w.do(scope, rec.Op, rec.ID)
+			}
+			w.done(scope)
+		}
+	})
+	// a trace recorded within one instant has no rate to keep
+	if speed > 0 && t.Duration() > 0 {
+		result.TargetRate = float64(len(t.Records)) / (t.Duration().Seconds() / speed)
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ReadTwitterTrace imports a twemcache production trace
+// (github.com/twitter/cache-trace), one csv line per request:
+// timestamp,anonymized key,key size,value size,client id,operation,TTL
+// with the timestamp and the TTL in seconds
+func ReadTwitterTrace(r io.Reader) (*Trace, error) {
+	b := newTraceBuilder()
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = 7
+	cr.ReuseRecord = true
+	for line := 1; ; line++ {
+		fields, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: timestamp: %v", line, err)
+		}
+		size, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: value size: %v", line, err)
+		}
+		op, err := parseTraceOp(fields[5])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		ttl, err := strconv.ParseInt(fields[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: ttl: %v", line, err)
+		}
+		b.add(time.Duration(ts)*time.Second, op, fields[1], size, time.Duration(ttl)*time.Second)
+	}
+	return b.done(), nil
+}
+
+// oracleGeneralRecordSize is the size of a libCacheSim oracleGeneral record:
+// uint32 timestamp (s), uint64 object id, uint32 object size, int64 next
+// access, all little endian
+const oracleGeneralRecordSize = 24
+
+// ReadOracleGeneralTrace imports a libCacheSim oracleGeneral trace, the
+// format of most published block and CDN traces. It only holds reads, misses
+// are meant to be filled, so replay it with FillOnMiss
+func ReadOracleGeneralTrace(r io.Reader) (*Trace, error) {
+	b := newTraceBuilder()
+	br := bufio.NewReader(r)
+	var rec [oracleGeneralRecordSize]byte
+	for {
+		_, err := io.ReadFull(br, rec[:])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts := binary.LittleEndian.Uint32(rec[0:4])
+		obj := binary.LittleEndian.Uint64(rec[4:12])
+		size := binary.LittleEndian.Uint32(rec[12:16])
+		b.add(time.Duration(ts)*time.Second, OpRead, strconv.FormatUint(obj, 10), int(size), 0)
+	}
+	return b.done(), nil
+}
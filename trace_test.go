@@ -0,0 +1,140 @@
+package benchmark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testTrace() *Trace {
+	return &Trace{
+		Keys: 3,
+		Records: []TraceRecord{
+			{At: 0, Op: OpWrite, ID: 0, ValueSize: 512, TTL: time.Minute},
+			{At: 1500, Op: OpRead, ID: 0, ValueSize: 512},
+			{At: 1500, Op: OpRead, ID: 1},
+			{At: time.Second, Op: OpDelete, ID: 2},
+		},
+	}
+}
+
+func TestTraceBinaryRoundTrip(t *testing.T) {
+	want := testTrace()
+	buf := &bytes.Buffer{}
+	if err := WriteTraceBinary(buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTraceBinary(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	bad := testTrace()
+	bad.Records[1].Op = OpVerify
+	buf.Reset()
+	if err := WriteTraceBinary(buf, bad); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTraceBinary(buf); err == nil {
+		t.Fatal("unknown operation accepted")
+	}
+}
+
+func TestTraceJSONLRoundTrip(t *testing.T) {
+	want := testTrace()
+	buf := &bytes.Buffer{}
+	if err := WriteTraceJSONL(buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTraceJSONL(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestTwitterTrace(t *testing.T) {
+	in := "100,keyA,4,300,1,get,0\n101,keyB,4,20,2,set,600\n103,keyA,4,0,1,delete,0\n"
+	got, err := ReadTwitterTrace(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Trace{
+		Keys: 2,
+		Records: []TraceRecord{
+			{At: 0, Op: OpRead, ID: 0, ValueSize: 300},
+			{At: time.Second, Op: OpWrite, ID: 1, ValueSize: 20, TTL: 10 * time.Minute},
+			{At: 3 * time.Second, Op: OpDelete, ID: 0},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestOracleGeneralTrace(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for _, rec := range []struct {
+		ts   uint32
+		obj  uint64
+		size uint32
+	}{{10, 42, 4096}, {12, 7, 100}, {15, 42, 4096}} {
+		binary.Write(buf, binary.LittleEndian, rec.ts)
+		binary.Write(buf, binary.LittleEndian, rec.obj)
+		binary.Write(buf, binary.LittleEndian, rec.size)
+		binary.Write(buf, binary.LittleEndian, int64(-1))
+	}
+	got, err := ReadOracleGeneralTrace(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Keys != 2 || len(got.Records) != 3 || got.Records[2].ID != 0 || got.Duration() != 5*time.Second {
+		t.Fatalf("unexpected trace %+v", got)
+	}
+}
+
+func TestReplayTrace(t *testing.T) {
+	wl := DefaultWorkload
+	wl.Goroutines = 2
+	wl.OpsPerRequest = 2
+	result, err := ReplayTrace(NewTestMap(16), &wl, testTrace(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.WriteSuccess != 1 || result.ReadSuccess != 1 || result.ReadMiss != 1 || result.DelMiss != 1 {
+		t.Fatalf("unexpected result %s", result)
+	}
+}
+
+func TestReplayTraceValueSize(t *testing.T) {
+	wl := DefaultWorkload
+	wl.Goroutines = 1
+	wl.FillOnMiss = true
+	cache := NewTestMap(16)
+	trace := &Trace{Keys: 2, Records: []TraceRecord{
+		{Op: OpWrite, ID: 0, ValueSize: 4096},
+		{Op: OpRead, ID: 1, ValueSize: 100},
+	}}
+	// recorded within one instant
+	result, err := ReplayTrace(cache, &wl, trace, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TargetRate != 0 || result.WriteSuccess != 2 {
+		t.Fatalf("unexpected result %s", result)
+	}
+	for _, rec := range trace.Records {
+		v, _ := cache.Get(GetKey(rec.ID))
+		data, _ := SerializeTestStruct(v)
+		if len(data) != rec.ValueSize {
+			t.Errorf("record %d: %d bytes written, recorded %d", rec.ID, len(data), rec.ValueSize)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time in whole seconds, it's the Timer of heyicache and
+// freecache so the same clock can be handed to both
+type Clock interface {
+	Now() uint32
+}
+
+// wallClock is the system clock, the one the caches use by default
+type wallClock struct{}
+
+func (wallClock) Now() uint32 {
+	return uint32(time.Now().Unix())
+}
+
+// SimClock is a clock the workload moves forward, entries expire after so
+// many operations instead of after so much real time. It starts at the
+// system time so the caches see a plausible epoch
+type SimClock struct {
+	base    uint32
+	elapsed atomic.Int64 // ns
+}
+
+func NewSimClock() *SimClock {
+	return &SimClock{base: wallClock{}.Now()}
+}
+
+func (c *SimClock) Now() uint32 {
+	return c.base + uint32(c.elapsed.Load()/int64(time.Second))
+}
+
+// Advance moves the clock forward by d
+func (c *SimClock) Advance(d time.Duration) {
+	c.elapsed.Add(int64(d))
+}
+
+// Elapsed is the simulated time since the clock was created
+func (c *SimClock) Elapsed() time.Duration {
+	return time.Duration(c.elapsed.Load())
+}
+
+// TTLDistribution gives every record its ttl. A record gets the same ttl at
+// every write, like the keys of one class would in an application
+type TTLDistribution interface {
+	Name() string
+	TTL(id int) time.Duration
+}
+
+// FixedTTL expires every record after the same time
+type FixedTTL struct {
+	After time.Duration
+}
+
+func (d FixedTTL) Name() string { return "fixed-" + d.After.String() }
+
+func (d FixedTTL) TTL(int) time.Duration { return d.After }
+
+// UniformTTL spreads the ttls of the records evenly over [Min, Max)
+type UniformTTL struct {
+	Min, Max time.Duration
+}
+
+func (d UniformTTL) Name() string { return "uniform-" + d.Min.String() + "-" + d.Max.String() }
+
+func (d UniformTTL) TTL(id int) time.Duration {
+	return d.Min + time.Duration(recordFraction(id)*float64(d.Max-d.Min))
+}
+
+// ExponentialTTL gives most records a short ttl and a few a long one, with
+// Mean as average
+type ExponentialTTL struct {
+	Mean time.Duration
+}
+
+func (d ExponentialTTL) Name() string { return "exp-" + d.Mean.String() }
+
+func (d ExponentialTTL) TTL(id int) time.Duration {
+	return time.Duration(-math.Log(1-recordFraction(id)) * float64(d.Mean))
+}
+
+// recordFraction maps id to a fraction in [0, 1) that looks random but is
+// the same at every call, splitmix64's finalizer
+func recordFraction(id int) float64 {
+	x := uint64(id) + 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
+
+// ParseTTLDistribution parses fixed-30s, uniform-10s-5m or exp-1m
+func ParseTTLDistribution(s string) (TTLDistribution, error) {
+	parts := strings.Split(s, "-")
+	var params []time.Duration
+	for _, p := range parts[1:] {
+		d, err := time.ParseDuration(p)
+		if err != nil {
+			return nil, fmt.Errorf("ttl distribution %q: %v", s, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("ttl distribution %q: ttls must > 0", s)
+		}
+		params = append(params, d)
+	}
+	want := map[string]int{"fixed": 1, "uniform": 2, "exp": 1}
+	n, ok := want[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown ttl distribution %q, want fixed-30s, uniform-10s-5m or exp-1m", s)
+	}
+	if len(params) != n {
+		return nil, fmt.Errorf("ttl distribution %q: want %d durations", s, n)
+	}
+	switch parts[0] {
+	case "fixed":
+		return FixedTTL{After: params[0]}, nil
+	case "uniform":
+		if params[1] < params[0] {
+			return nil, fmt.Errorf("ttl distribution %q: max below min", s)
+		}
+		return UniformTTL{Min: params[0], Max: params[1]}, nil
+	}
+	return ExponentialTTL{Mean: params[0]}, nil
+}
+
+// expiryTracker knows when the entry of every record expires, by the clock
+// the cache runs on, so a read can tell whether the cache served an entry
+// past its ttl
+type expiryTracker struct {
+	sim      *SimClock       // nil on the system clock
+	expireAt []atomic.Uint32 // 0 when unknown or never, the records inserted past wl.Records aren't tracked
+}
+
+// newExpiryTracker returns the tracker of wl, nil when its records don't
+// expire. The preloaded records were written before the current time, so
+// their entries expire at the latest ttl after it
+func newExpiryTracker(wl *Workload) *expiryTracker {
+	if wl.TTL == nil {
+		return nil
+	}
+	t := &expiryTracker{sim: wl.Clock, expireAt: make([]atomic.Uint32, wl.Records)}
+	if wl.Preload {
+		for id := range t.expireAt {
+			t.written(id, wl.TTL.TTL(id))
+		}
+	}
+	return t
+}
+
+// writing forgets the expiry of id while it's written, a read racing with
+// the write isn't checked
+func (t *expiryTracker) writing(id int) {
+	if id < len(t.expireAt) {
+		t.expireAt[id].Store(0)
+	}
+}
+
+// written records the expiry of the entry of id, the current time is read
+// after the write so it's never earlier than the one the cache used
+func (t *expiryTracker) written(id int, ttl time.Duration) {
+	if id >= len(t.expireAt) {
+		return
+	}
+	var at uint32
+	if ttl > 0 {
+		at = t.deadline(ttl)
+	}
+	t.expireAt[id].Store(at)
+}
+
+// deadline is the first second an entry written now with ttl must be gone
+func (t *expiryTracker) deadline(ttl time.Duration) uint32 {
+	if t.sim != nil {
+		// only freecache and heyicache run on it, they count whole seconds
+		return t.sim.Now() + uint32(ttlSeconds(ttl))
+	}
+	// go-cache counts nanoseconds, its entries are only sure to be gone the
+	// second after
+	return uint32(time.Now().Add(ttl).Unix()) + 1
+}
+
+// now is the current second of the clock the cache runs on
+func (t *expiryTracker) now() uint32 {
+	if t.sim != nil {
+		return t.sim.Now()
+	}
+	return wallClock{}.Now()
+}
+
+// expiry returns when the entry of id expires, 0 when it doesn't or isn't
+// known
+func (t *expiryTracker) expiry(id int) uint32 {
+	if id >= len(t.expireAt) {
+		return 0
+	}
+	return t.expireAt[id].Load()
+}
+
+// withSimClock makes factories build their caches on the simulated clock of
+// wl, when it has one. The caches that can't take a clock are dropped when
+// all were picked, an error otherwise
+func withSimClock(factories []AdapterFactory, wl *Workload, all bool) ([]AdapterFactory, error) {
+	if wl.Clock == nil {
+		return factories, nil
+	}
+	var clocked []AdapterFactory
+	for _, factory := range factories {
+		if factory.NewOn == nil {
+			if all {
+				continue
+			}
+			return nil, fmt.Errorf("cache %q can't run on a simulated clock, only %s can", factory.Name, strings.Join(clockAdapterNames(), " and "))
+		}
+		clocked = append(clocked, factory.WithClock(wl.Clock))
+	}
+	return clocked, nil
+}
+
+// clockAdapterNames names the caches that can run on a simulated clock
+func clockAdapterNames() []string {
+	var names []string
+	for _, factory := range Adapters {
+		if factory.NewOn != nil {
+			names = append(names, factory.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,122 @@
+package benchmark
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestParseTTLDistribution(t *testing.T) {
+	for _, s := range []string{"fixed-30s", "uniform-10s-5m0s", "exp-1m0s"} {
+		d, err := ParseTTLDistribution(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Name() != s {
+			t.Errorf("%s parsed as %s", s, d.Name())
+		}
+	}
+	for _, s := range []string{"", "fixed", "fixed-0s", "uniform-1m", "uniform-5m-10s", "exp-1m-2m", "zipfian-1m"} {
+		if _, err := ParseTTLDistribution(s); err == nil {
+			t.Errorf("%q parsed", s)
+		}
+	}
+	d := UniformTTL{Min: 10 * time.Second, Max: 20 * time.Second}
+	sum := time.Duration(0)
+	for id := 0; id < 1000; id++ {
+		ttl := d.TTL(id)
+		if ttl < d.Min || ttl >= d.Max || ttl != d.TTL(id) {
+			t.Fatalf("record %d: ttl %s", id, ttl)
+		}
+		sum += ttl
+	}
+	if mean := sum / 1000; mean < 14*time.Second || mean > 16*time.Second {
+		t.Errorf("mean ttl %s", mean)
+	}
+}
+
+// ttlWorkload covers 100 simulated seconds over records expiring within 10
+func ttlWorkload() Workload {
+	wl := DefaultWorkload.WithMix("ttl", 90, 10, 0, 0, 0).WithKeys(UniformKeys{})
+	wl.Records = 2000
+	wl.Goroutines = 4
+	wl.OpsPerRequest = 10
+	wl.FillOnMiss = true
+	return wl.WithTTL(UniformTTL{Min: time.Second, Max: 10 * time.Second}, 10*time.Millisecond)
+}
+
+func TestTTLWorkload(t *testing.T) {
+	for _, factory := range []AdapterFactory{
+		{Name: "FreeCache", NewOn: func(c Clock) (CacheAdapter, error) { return NewTestFreeCacheOn(16<<20, c), nil }},
+		{Name: "HeyiCache", NewOn: func(c Clock) (CacheAdapter, error) { return NewTestHeyiCacheOn(32, c), nil }},
+	} {
+		wl := ttlWorkload()
+		factories, err := withSimClock([]AdapterFactory{factory}, &wl, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache, err := factories[0].New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		LoadRecords(cache, &wl)
+		result := RunWorkload(cache, &wl, 250)
+		closeCache(cache)
+		if result.SimElapsed != 100*time.Second {
+			t.Errorf("%s: %s simulated", factory.Name, result.SimElapsed)
+		}
+		if result.TTLChecked == 0 || result.Expired == 0 || result.ReadMiss == 0 {
+			t.Errorf("%s: nothing expired: %v", factory.Name, result)
+		}
+		if result.TTLStale > 0 {
+			t.Errorf("%s: %d stale reads", factory.Name, result.TTLStale)
+		}
+	}
+}
+
+// ttlIgnoringMap takes a ttl and keeps the entry for ever
+type ttlIgnoringMap struct {
+	*TestMap
+}
+
+func (m ttlIgnoringMap) SetWithTTL(key string, value *TestStruct, _ time.Duration) error {
+	return m.Set(key, value)
+}
+
+func TestTTLStaleReads(t *testing.T) {
+	wl := ttlWorkload()
+	cache := ttlIgnoringMap{NewTestMap(wl.Records)}
+	LoadRecords(cache, &wl)
+	result := RunWorkload(cache, &wl, 250)
+	if result.TTLStale == 0 || result.ReadMiss > 0 {
+		t.Errorf("a cache ignoring ttls served %d stale reads and %d misses", result.TTLStale, result.ReadMiss)
+	}
+}
+
+func TestTTLFlags(t *testing.T) {
+	cfg, err := ParseCLI([]string{"-ttl", "exp-1m", "-sim-tick", "1ms"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wl, err := cfg.BuildWorkload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wl.TTL != (ExponentialTTL{Mean: time.Minute}) || wl.SimTick != time.Millisecond || wl.Clock == nil {
+		t.Fatalf("unexpected workload %s", wl.String())
+	}
+	// the result document keeps them for compare
+	rerun, err := wl.Params().Workload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rerun.TTL != wl.TTL || rerun.SimTick != wl.SimTick || rerun.Clock == nil || rerun.Clock == wl.Clock {
+		t.Fatalf("rerun as %s", rerun.String())
+	}
+	if cfg, err = ParseCLI([]string{"-sim-tick", "1ms"}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.BuildWorkload(); err == nil {
+		t.Fatal("a sim tick without ttl was accepted")
+	}
+}
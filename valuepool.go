@@ -0,0 +1,213 @@
+package benchmark
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolMode tells when the keys and values of the records are built
+type PoolMode int
+
+const (
+	PoolOff         PoolMode = iota // in the measured loop, like the original benchmark
+	PoolPregenerate                 // all of them before the run
+	PoolMemoize                     // a value the first time it's used, keys before the run
+)
+
+var poolModeNames = [...]string{"off", "pregenerate", "memoize"}
+
+func (m PoolMode) String() string {
+	if m >= 0 && int(m) < len(poolModeNames) {
+		return poolModeNames[m]
+	}
+	return fmt.Sprintf("pool(%d)", int(m))
+}
+
+func ParsePoolMode(s string) (PoolMode, error) {
+	if s == "" {
+		return PoolOff, nil
+	}
+	for i, name := range poolModeNames {
+		if name == s {
+			return PoolMode(i), nil
+		}
+	}
+	return PoolOff, fmt.Errorf("unknown pool mode %q, want off, pregenerate or memoize", s)
+}
+
+// ValuePool keeps the keys and values of records [0, Records) of a workload
+// so the measured loop only looks them up. The values are shared by every
+// goroutine and must not be modified. Records outside of the pool, eg: the
+// inserts of the latest distribution, are built on every use
+type ValuePool struct {
+	profile *ValueProfile
+	keys    []string
+	values  []*TestStruct
+	once    []sync.Once // one per record when memoizing, nil when pregenerated
+	builds  atomic.Int64
+}
+
+// NewValuePool builds the pool of wl in mode, pregenerating spreads the work
+// over GOMAXPROCS goroutines
+func NewValuePool(wl *Workload, mode PoolMode) *ValuePool {
+	p := &ValuePool{
+		profile: wl.Values,
+		keys:    make([]string, wl.Records),
+		values:  make([]*TestStruct, wl.Records),
+	}
+	if mode == PoolMemoize {
+		p.once = make([]sync.Once, wl.Records)
+	}
+	procs := runtime.GOMAXPROCS(0)
+	wg := &sync.WaitGroup{}
+	wg.Add(procs)
+	for g := 0; g < procs; g++ {
+		go func(gIdx int) {
+			defer wg.Done()
+			for id := gIdx; id < wl.Records; id += procs {
+				if p.once == nil {
+					p.keys[id], p.values[id] = wl.build(id)
+				} else {
+					p.keys[id] = GetKey(id)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	return p
+}
+
+// Key returns the key of record id
+func (p *ValuePool) Key(id int) string {
+	if id >= 0 && id < len(p.keys) {
+		return p.keys[id]
+	}
+	return GetKey(id)
+}
+
+// Get returns the key and the value of record id
+func (p *ValuePool) Get(id int) (string, *TestStruct) {
+	if id < 0 || id >= len(p.values) {
+		p.builds.Add(1)
+		return newTestStruct(p.profile, id)
+	}
+	if p.once != nil {
+		p.once[id].Do(func() {
+			p.builds.Add(1)
+			_, p.values[id] = newTestStruct(p.profile, id)
+		})
+	}
+	return p.keys[id], p.values[id]
+}
+
+// Builds is the number of values Get built since the pool was created: the
+// first use of a memoized record and every use of a record outside the pool
+func (p *ValuePool) Builds() int64 {
+	return p.builds.Load()
+}
+
+// HarnessCost is what the benchmark itself spends to issue an operation,
+// measured on a warm pool before the run
+type HarnessCost struct {
+	KeyNs   float64 // building or looking up the key of a read
+	ValueNs float64 // building or looking up the key and the value of a write or a verification
+	BuildNs float64 // building a value the pool doesn't hold, 0 without a pool
+}
+
+// harnessSamples is the number of records timed by MeasureHarness
+const harnessSamples = 256
+
+// MeasureHarness times how long wl takes to produce keys and values, and with
+// a pool how long it takes to build a value it doesn't hold
+func MeasureHarness(wl *Workload) HarnessCost {
+	n := min(wl.Records, harnessSamples)
+	if n <= 0 {
+		return HarnessCost{}
+	}
+	var cost HarnessCost
+	if wl.valuePool() != nil {
+		start := time.Now()
+		for id := 0; id < n; id++ {
+			wl.build(id)
+		}
+		cost.BuildNs = float64(time.Since(start)) / float64(n)
+	}
+	// the first pass fills a memoizing pool
+	for id := 0; id < n; id++ {
+		wl.NewTestStruct(id)
+	}
+	start := time.Now()
+	for id := 0; id < n; id++ {
+		_ = wl.Key(id)
+	}
+	cost.KeyNs = float64(time.Since(start)) / float64(n)
+	start = time.Now()
+	for id := 0; id < n; id++ {
+		wl.NewTestStruct(id)
+	}
+	cost.ValueNs = float64(time.Since(start)) / float64(n)
+	return cost
+}
+
+// perOp spreads the cost over the operations of result: every operation
+// needs a key, writes and verifications need a value too, and builds of them
+// were built by the pool during the run
+func (cost HarnessCost) perOp(result *BenchResult, builds int64) float64 {
+	ops := result.Ops()
+	if ops == 0 {
+		return 0
+	}
+	values := result.WriteSuccess + result.WriteFail + result.CheckSuccess + result.CheckFail
+	total := cost.KeyNs*float64(ops-result.WriteSuccess-result.WriteFail) + cost.ValueNs*float64(values) + cost.BuildNs*float64(builds)
+	return total / float64(ops)
+}
+
+// prepared is what Workload.Prepare built, it's rebuilt when the fields it
+// depends on change
+type prepared struct {
+	mode    PoolMode
+	records int
+	values  *ValueProfile
+	pool    *ValuePool
+	cost    HarnessCost
+}
+
+// Prepare builds the value pool of wl and measures the harness cost, it runs
+// before the timer starts. Running a workload prepares it when it's not
+func (wl *Workload) Prepare() {
+	if p := wl.prep; p != nil && p.mode == wl.Pool && p.records == wl.Records && p.values == wl.Values {
+		return
+	}
+	wl.prep = &prepared{mode: wl.Pool, records: wl.Records, values: wl.Values}
+	if wl.Pool != PoolOff {
+		wl.prep.pool = NewValuePool(wl, wl.Pool)
+	}
+	wl.prep.cost = MeasureHarness(wl)
+}
+
+// valuePool returns the pool of wl, nil when there's none or it was built
+// for other values
+func (wl *Workload) valuePool() *ValuePool {
+	if p := wl.prep; p != nil && p.pool != nil && p.values == wl.Values {
+		return p.pool
+	}
+	return nil
+}
+
+// WithPool returns a copy of wl building its keys and values in mode
+func (wl Workload) WithPool(mode PoolMode) Workload {
+	wl.Pool = mode
+	wl.prep = nil
+	return wl
+}
+
+// Key returns the key of record id
+func (wl *Workload) Key(id int) string {
+	if pool := wl.valuePool(); pool != nil {
+		return pool.Key(id)
+	}
+	return GetKey(id)
+}
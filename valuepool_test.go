@@ -0,0 +1,82 @@
+package benchmark
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValuePool(t *testing.T) {
+	for _, mode := range []PoolMode{PoolPregenerate, PoolMemoize} {
+		wl := DefaultWorkload.WithValues(ValueProfiles["uniform"]).WithPool(mode)
+		wl.Records = 100
+		wl.Prepare()
+		pool := wl.valuePool()
+		if pool == nil {
+			t.Fatalf("%s: no pool after Prepare", mode)
+		}
+		for _, id := range []int{0, 57, 99, 100, 1000} {
+			k, v := wl.NewTestStruct(id)
+			wantK, wantV := ValueProfiles["uniform"].NewTestStruct(id)
+			if k != wantK || wl.Key(id) != wantK || !reflect.DeepEqual(v, wantV) {
+				t.Errorf("%s: record %d differs from the profile", mode, id)
+			}
+		}
+		if _, v := wl.NewTestStruct(7); v != pool.values[7] {
+			t.Errorf("%s: record 7 isn't served from the pool", mode)
+		}
+
+		// other values must not be served from the pool built for uniform
+		other := wl.WithValues(nil)
+		if _, v := other.NewTestStruct(3); v.TestName != "test_name_3" {
+			t.Errorf("%s: stale pool served record 3 as %q", mode, v.TestName)
+		}
+	}
+}
+
+func TestParsePoolMode(t *testing.T) {
+	for _, mode := range []PoolMode{PoolOff, PoolPregenerate, PoolMemoize} {
+		if got, err := ParsePoolMode(mode.String()); err != nil || got != mode {
+			t.Errorf("ParsePoolMode(%q) = %v, %v", mode, got, err)
+		}
+	}
+	if _, err := ParsePoolMode("lazy"); err == nil {
+		t.Error("ParsePoolMode accepted lazy")
+	}
+}
+
+func TestHarnessCost(t *testing.T) {
+	wl := DefaultWorkload
+	wl.Records = 1000
+	wl.Prepare()
+	off := wl.prep.cost
+	pooled := wl.WithPool(PoolPregenerate)
+	pooled.Prepare()
+	if off.ValueNs <= 0 || pooled.prep.cost.ValueNs >= off.ValueNs {
+		t.Errorf("building a value costs %.0fns, a pool lookup %.0fns", off.ValueNs, pooled.prep.cost.ValueNs)
+	}
+	// a verification is a read that is also checked
+	result := &BenchResult{ReadSuccess: 99, WriteSuccess: 1, CheckSuccess: 1}
+	want := (off.KeyNs*99 + off.ValueNs*2) / 100
+	if got := off.perOp(result, 0); got != want {
+		t.Errorf("perOp = %f, want %f", got, want)
+	}
+
+	// a memoizing pool builds a value at its first use
+	memo := wl.WithPool(PoolMemoize)
+	memo.Prepare()
+	cost := memo.prep.cost
+	if cost.BuildNs <= cost.ValueNs {
+		t.Errorf("building a value costs %.0fns, a pool lookup %.0fns", cost.BuildNs, cost.ValueNs)
+	}
+	before := memo.prep.pool.Builds()
+	for id := 0; id < wl.Records; id++ {
+		memo.NewTestStruct(id)
+	}
+	if builds := memo.prep.pool.Builds() - before; builds != int64(wl.Records-harnessSamples) {
+		t.Errorf("%d values built at their first use", builds)
+	}
+	want = (cost.KeyNs*99 + cost.ValueNs*2 + cost.BuildNs*2) / 100
+	if got := cost.perOp(result, 2); got != want {
+		t.Errorf("perOp = %f, want %f", got, want)
+	}
+}
@@ -0,0 +1,262 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// SizeDistribution draws a length: of a string, of a slice or the number of
+// nested children
+type SizeDistribution interface {
+	Name() string
+	Sample(r *rand.Rand) int
+}
+
+// FixedSize is always the same length
+type FixedSize int
+
+func (d FixedSize) Name() string          { return fmt.Sprintf("fixed-%d", int(d)) }
+func (d FixedSize) Sample(*rand.Rand) int { return int(d) }
+
+// UniformSize is uniform in [Min, Max]
+type UniformSize struct {
+	Min, Max int
+}
+
+func (d UniformSize) Name() string { return fmt.Sprintf("uniform-%d-%d", d.Min, d.Max) }
+
+func (d UniformSize) Sample(r *rand.Rand) int {
+	return d.Min + r.IntN(d.Max-d.Min+1)
+}
+
+// LogNormalSize has most lengths around Median and a long tail, the shape
+// of most real value sizes. Sigma is the standard deviation of the log,
+// lengths are capped at Max
+type LogNormalSize struct {
+	Median float64
+	Sigma  float64
+	Max    int
+}
+
+func (d LogNormalSize) Name() string {
+	return fmt.Sprintf("lognormal-%g-%g", d.Median, d.Sigma)
+}
+
+func (d LogNormalSize) Sample(r *rand.Rand) int {
+	v := d.Median * math.Exp(d.Sigma*r.NormFloat64())
+	return min(int(v), d.Max)
+}
+
+// BimodalSize is Small, except LargePercent of the time where it's Large
+type BimodalSize struct {
+	Small, Large int
+	LargePercent float64
+}
+
+func (d BimodalSize) Name() string {
+	return fmt.Sprintf("bimodal-%d-%d-%g", d.Small, d.Large, d.LargePercent)
+}
+
+func (d BimodalSize) Sample(r *rand.Rand) int {
+	if r.Float64()*100 < d.LargePercent {
+		return d.Large
+	}
+	return d.Small
+}
+
+// ValueProfile builds TestStructs whose shape varies: the length of every
+// string and []byte, of every slice of scalars and strings, and the number
+// of nested children. A value only depends on its id, so the expected value
+// of a verification is built again from the id
+type ValueProfile struct {
+	Name     string
+	Strings  SizeDistribution
+	Slices   SizeDistribution
+	Children SizeDistribution
+	Seed     uint64
+}
+
+// ValueProfiles are the profiles selectable by name, "default" is the fixed
+// shape of NewTestStruct and isn't listed
+var ValueProfiles = map[string]*ValueProfile{
+	"small": {
+		Name:     "small",
+		Strings:  FixedSize(24),
+		Slices:   FixedSize(3),
+		Children: FixedSize(2),
+	},
+	"uniform": {
+		Name:     "uniform",
+		Strings:  UniformSize{8, 512},
+		Slices:   UniformSize{0, 16},
+		Children: UniformSize{0, 4},
+	},
+	"lognormal": {
+		Name:     "lognormal",
+		Strings:  LogNormalSize{Median: 64, Sigma: 1.2, Max: 64 << 10},
+		Slices:   LogNormalSize{Median: 4, Sigma: 0.8, Max: 256},
+		Children: UniformSize{0, 4},
+	},
+	"bimodal": {
+		Name:     "bimodal",
+		Strings:  BimodalSize{Small: 32, Large: 2048, LargePercent: 5},
+		Slices:   FixedSize(4),
+		Children: FixedSize(2),
+	},
+	// about 10KB to 40KB per entry: over heyicache's limit at 100MB
+	// (MaxSize/10240) and far below freecache's (size/1024)
+	"large": {
+		Name:     "large",
+		Strings:  UniformSize{256, 1024},
+		Slices:   FixedSize(4),
+		Children: UniformSize{1, 4},
+	},
+}
+
+// ValueProfileNames returns the profile names in a stable order, default
+// first
+func ValueProfileNames() []string {
+	names := make([]string, 0, len(ValueProfiles))
+	for name := range ValueProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{"default"}, names...)
+}
+
+// NewTestStruct returns the key and the value of record id
+func (p *ValueProfile) NewTestStruct(id int) (string, *TestStruct) {
+	r := rand.New(rand.NewPCG(p.Seed, uint64(id)))
+	str := func() string { return randString(r, p.Strings.Sample(r)) }
+	strs := func() []string {
+		s := make([]string, p.Slices.Sample(r))
+		for i := range s {
+			s[i] = str()
+		}
+		return s
+	}
+	uints := func() []uint64 {
+		u := make([]uint64, p.Slices.Sample(r))
+		for i := range u {
+			u[i] = r.Uint64()
+		}
+		return u
+	}
+	floats := func() []float32 {
+		f := make([]float32, p.Slices.Sample(r))
+		for i := range f {
+			f[i] = r.Float32()
+		}
+		return f
+	}
+	pbChild := func(offset int) *TestPBChild {
+		return &TestPBChild{
+			Id:          uint64(id + offset),
+			TestString:  str(),
+			TestStrings: strs(),
+			TestMap:     map[string]string{str(): str()},
+			TestUint64S: uints(),
+			TestBytes:   []byte(str()),
+			TestFloats:  floats(),
+		}
+	}
+	structChild := func(offset int) TestStructChild {
+		return TestStructChild{Id: uint64(id + offset), TestName: str(), TestSkip: str()}
+	}
+
+	pb := &TestPB{
+		Id:          uint64(id + 10000),
+		TestString:  str(),
+		TestStrings: strs(),
+		TestMap:     map[string]string{str(): str()},
+		TestUint64S: uints(),
+		TestBytes:   []byte(str()),
+		TestFloats:  floats(),
+		TestChild:   pbChild(1000),
+	}
+	for i := p.Children.Sample(r); i > 0; i-- {
+		pb.TestChildren = append(pb.TestChildren, pbChild(2000))
+	}
+
+	v := &TestStruct{
+		Id:        uint64(id),
+		TestName:  str(),
+		TestSkip:  str(),
+		TestChild: structChild(100),
+		TestProto: pb,
+		Flag:      uint8(id % 256),
+	}
+	for i := p.Children.Sample(r); i > 0; i-- {
+		v.TestChildren = append(v.TestChildren, structChild(200))
+	}
+	child := structChild(400)
+	v.TestChildPtr = &child
+	for i := p.Children.Sample(r); i > 0; i-- {
+		c := structChild(500)
+		v.TestChildrenPtr = append(v.TestChildrenPtr, &c)
+	}
+	return GetKey(id), v
+}
+
+// SizedTestStruct returns the key and the value of record id, a bare value
+// whose TestName makes it about size bytes once encoded by
+// SerializeTestStruct. The replay of a trace writes the values at the size
+// they were recorded with
+func SizedTestStruct(id, size int) (string, *TestStruct) {
+	v := &TestStruct{Id: uint64(id), TestProto: &TestPB{Id: uint64(id + 10000)}, Flag: uint8(id % 256)}
+	bare, _ := SerializeTestStruct(v)
+	if n := size - len(bare); n > 0 {
+		// the length of the name takes some bytes too
+		n -= uvarintLen(uint64(n)) - 1
+		v.TestName = randString(rand.New(rand.NewPCG(0, uint64(id))), n)
+	}
+	return GetKey(id), v
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-"
+
+// randString returns n random letters, one random number gives 10 of them
+func randString(r *rand.Rand, n int) string {
+	b := make([]byte, max(n, 0))
+	for i := 0; i < len(b); {
+		x := r.Uint64()
+		for j := 0; j < 10 && i < len(b); j++ {
+			b[i] = letters[x&63]
+			x >>= 6
+			i++
+		}
+	}
+	return string(b)
+}
+
+// ValueSizes samples the flat size (what heyicache stores) and the protobuf
+// size of the first records values, nil is the default shape
+func ValueSizes(p *ValueProfile, records int) (flat, protobuf Histogram) {
+	for id := 0; id < records; id++ {
+		_, v := newTestStruct(p, id)
+		flat.Record(int64(HeyiCacheFnTestStructIfc_.Size(v, true)))
+		protobuf.Record(int64(v.TestProto.Size()))
+	}
+	return flat, protobuf
+}
+
+// OverLimitPercent is the percentage of the records of wl too large for ifc,
+// 0 when ifc doesn't limit its entries
+func OverLimitPercent(ifc CacheAdapter, wl *Workload) float64 {
+	limiter, ok := ifc.(EntryLimiter)
+	accounter, ok2 := ifc.(EntryAccounter)
+	if !ok || !ok2 || wl.Records == 0 {
+		return 0
+	}
+	limit := limiter.MaxEntryBytes()
+	over := 0
+	for id := 0; id < wl.Records; id++ {
+		k, v := wl.NewTestStruct(id)
+		if payload, _ := accounter.EntryBytes(k, v); len(k)+payload > limit {
+			over++
+		}
+	}
+	return float64(over) / float64(wl.Records) * 100
+}
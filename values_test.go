@@ -0,0 +1,66 @@
+package benchmark
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"testing"
+)
+
+func TestValueProfileDeterministic(t *testing.T) {
+	for _, name := range ValueProfileNames()[1:] {
+		p := ValueProfiles[name]
+		k1, v1 := p.NewTestStruct(42)
+		k2, v2 := p.NewTestStruct(42)
+		if k1 != k2 || !reflect.DeepEqual(v1, v2) {
+			t.Errorf("%s: record 42 differs between two calls", name)
+		}
+		if mismatches := VerifyTestStruct(v1, v2, VerifyFull); len(mismatches) > 0 {
+			t.Errorf("%s: equal values mismatch: %v", name, mismatches)
+		}
+		if _, v3 := p.NewTestStruct(43); reflect.DeepEqual(v1, v3) {
+			t.Errorf("%s: records 42 and 43 are equal", name)
+		}
+	}
+}
+
+func TestSizeDistributionBounds(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	cases := []struct {
+		d        SizeDistribution
+		min, max int
+	}{
+		{FixedSize(7), 7, 7},
+		{UniformSize{3, 9}, 3, 9},
+		{LogNormalSize{Median: 64, Sigma: 2, Max: 1000}, 0, 1000},
+		{BimodalSize{Small: 1, Large: 100, LargePercent: 50}, 1, 100},
+	}
+	for _, c := range cases {
+		seen := map[int]bool{}
+		for i := 0; i < 10000; i++ {
+			n := c.d.Sample(r)
+			if n < c.min || n > c.max {
+				t.Fatalf("%s: sampled %d out of [%d, %d]", c.d.Name(), n, c.min, c.max)
+			}
+			seen[n] = true
+		}
+		if c.min != c.max && len(seen) < 2 {
+			t.Errorf("%s: always sampled the same length", c.d.Name())
+		}
+	}
+}
+
+func TestOverLimitPercent(t *testing.T) {
+	wl := DefaultWorkload.WithValues(ValueProfiles["large"])
+	wl.Records = 200
+	heyi := NewTestHeyiCache(100)
+	free := NewTestFreeCache(100 * 1024 * 1024)
+	if p := OverLimitPercent(heyi, &wl); p == 0 {
+		t.Errorf("heyicache: no large value is over its limit of %d bytes", heyi.MaxEntryBytes())
+	}
+	if p := OverLimitPercent(free, &wl); p != 0 {
+		t.Errorf("freecache: %.1f%% of the large values are over its limit of %d bytes", p, free.MaxEntryBytes())
+	}
+	if p := OverLimitPercent(NewTestMap(1), &wl); p != 0 {
+		t.Errorf("map: %.1f%% over the limit, want 0 without a limit", p)
+	}
+}
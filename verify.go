@@ -0,0 +1,255 @@
+package benchmark
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// VerifyMode tells which part of a value survives a round trip through a
+// cache
+type VerifyMode int
+
+const (
+	VerifyFull  VerifyMode = iota // the value comes back as it was set
+	VerifyFlat                    // copied by value like heyicache: skip-tagged fields and maps come back zero
+	VerifyProto                   // only the protobuf field round trips, see PartialVerifier
+)
+
+var verifyModeNames = [...]string{"full", "flat", "proto"}
+
+func (m VerifyMode) String() string {
+	if m >= 0 && int(m) < len(verifyModeNames) {
+		return verifyModeNames[m]
+	}
+	return fmt.Sprintf("verify(%d)", int(m))
+}
+
+// FlatCopier is implemented by caches that store a copy of the value without
+// its skip-tagged fields and maps
+type FlatCopier interface {
+	CopiesFlat() bool
+}
+
+// VerifyModeOf returns how the values read from ifc are verified
+func VerifyModeOf(ifc TestCacheIfc) VerifyMode {
+	if Capabilities(ifc).Has(CapPartialVerify) {
+		return VerifyProto
+	}
+	if c, ok := ifc.(FlatCopier); ok && c.CopiesFlat() {
+		return VerifyFlat
+	}
+	return VerifyFull
+}
+
+// skipTag is the struct tag of the fields heyicache doesn't store
+const skipTag = "skip"
+
+// Mismatch is one difference between a value read from a cache and the
+// expected one, Path is the Go expression of the field, eg:
+// TestProto.TestChildren[1].TestStrings[0]
+type Mismatch struct {
+	Path string
+	Got  string
+	Want string
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s: got %s, want %s", m.Path, m.Got, m.Want)
+}
+
+// VerifyTestStruct compares got with want in mode and returns every mismatch
+func VerifyTestStruct(got, want *TestStruct, mode VerifyMode) []Mismatch {
+	if mode == VerifyProto {
+		var gotPB, wantPB *TestPB
+		if got != nil {
+			gotPB = got.TestProto
+		}
+		if want != nil {
+			wantPB = want.TestProto
+		}
+		return DeepVerify("TestProto", gotPB, wantPB, false)
+	}
+	return DeepVerify("", got, want, mode == VerifyFlat)
+}
+
+// DeepVerify walks got and want, two values of the same type, and returns
+// the path of every difference under root. With flat the fields tagged
+// `heyicache:"skip"` and the kinds a flat copy can't hold (maps, channels,
+// funcs) are expected to be zero instead of equal. Unexported fields are
+// ignored
+func DeepVerify(root string, got, want any, flat bool) []Mismatch {
+	v := &verifier{flat: flat}
+	gv, wv := reflect.ValueOf(got), reflect.ValueOf(want)
+	if gv.Type() != wv.Type() {
+		return []Mismatch{{Path: root, Got: gv.Type().String(), Want: wv.Type().String()}}
+	}
+	v.walk(root, gv, wv)
+	return v.mismatches
+}
+
+type verifier struct {
+	flat       bool
+	ignoreSkip bool // leave the skip-tagged fields alone instead of expecting them zero or equal
+	mismatches []Mismatch
+}
+
+func (v *verifier) mismatch(path string, got, want string) {
+	if path == "" {
+		path = "."
+	}
+	v.mismatches = append(v.mismatches, Mismatch{Path: path, Got: got, Want: want})
+}
+
+func (v *verifier) walk(path string, got, want reflect.Value) {
+	switch want.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if got.IsNil() || want.IsNil() {
+			if got.IsNil() != want.IsNil() {
+				v.mismatch(path, nilness(got), nilness(want))
+			}
+			return
+		}
+		if want.Kind() == reflect.Interface && got.Elem().Type() != want.Elem().Type() {
+			v.mismatch(path, got.Elem().Type().String(), want.Elem().Type().String())
+			return
+		}
+		v.walk(path, got.Elem(), want.Elem())
+	case reflect.Struct:
+		t := want.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			p := joinPath(path, f.Name)
+			if isSkipped(f) {
+				if v.ignoreSkip {
+					continue
+				}
+				if v.flat {
+					v.expectZero(p, got.Field(i))
+					continue
+				}
+			}
+			v.walk(p, got.Field(i), want.Field(i))
+		}
+	case reflect.Map:
+		if v.flat {
+			v.expectZero(path, got)
+			return
+		}
+		v.walkMap(path, got, want)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		if v.flat {
+			v.expectZero(path, got)
+		}
+	case reflect.Slice, reflect.Array:
+		if got.Len() != want.Len() {
+			v.mismatch(path, fmt.Sprintf("len %d", got.Len()), fmt.Sprintf("len %d", want.Len()))
+			return
+		}
+		for i := 0; i < want.Len(); i++ {
+			v.walk(fmt.Sprintf("%s[%d]", path, i), got.Index(i), want.Index(i))
+		}
+	default:
+		if !scalarEqual(got, want) {
+			v.mismatch(path, format(got), format(want))
+		}
+	}
+}
+
+// walkMap compares the entries of two maps, in the order of their keys
+func (v *verifier) walkMap(path string, got, want reflect.Value) {
+	keys := want.MapKeys()
+	for _, k := range got.MapKeys() {
+		if !want.MapIndex(k).IsValid() {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return format(keys[i]) < format(keys[j]) })
+	for _, k := range keys {
+		p := fmt.Sprintf("%s[%s]", path, format(k))
+		g, w := got.MapIndex(k), want.MapIndex(k)
+		switch {
+		case !g.IsValid():
+			v.mismatch(p, "missing", format(w))
+		case !w.IsValid():
+			v.mismatch(p, format(g), "missing")
+		default:
+			v.walk(p, g, w)
+		}
+	}
+}
+
+// expectZero only looks at the length of strings, slices and maps: a field a
+// flat copy doesn't own may point to freed memory, loading that pointer
+// would hand it to the garbage collector
+func (v *verifier) expectZero(path string, got reflect.Value) {
+	if got.IsZero() {
+		return
+	}
+	switch got.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		v.mismatch(path, fmt.Sprintf("len %d", got.Len()), "zero")
+	default:
+		v.mismatch(path, "non-zero", "zero")
+	}
+}
+
+func isSkipped(f reflect.StructField) bool {
+	return f.Tag.Get("heyicache") == skipTag
+}
+
+func scalarEqual(got, want reflect.Value) bool {
+	switch want.Kind() {
+	case reflect.Bool:
+		return got.Bool() == want.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return got.Int() == want.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return got.Uint() == want.Uint()
+	case reflect.Float32, reflect.Float64:
+		g, w := got.Float(), want.Float()
+		return g == w || g != g && w != w // NaN is NaN
+	case reflect.Complex64, reflect.Complex128:
+		return got.Complex() == want.Complex()
+	case reflect.String:
+		return got.String() == want.String()
+	}
+	return true
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func nilness(v reflect.Value) string {
+	if v.IsNil() {
+		return "nil"
+	}
+	return "non-nil"
+}
+
+// maxFormatLen is the length a value is cut to in a mismatch
+const maxFormatLen = 64
+
+func format(v reflect.Value) string {
+	var s string
+	switch {
+	case v.Kind() == reflect.String:
+		s = fmt.Sprintf("%q", v.String())
+	case v.CanInterface():
+		s = fmt.Sprintf("%v", v.Interface())
+	default:
+		s = v.Kind().String()
+	}
+	if len(s) > maxFormatLen {
+		s = s[:maxFormatLen] + "..."
+	}
+	return strings.ToValidUTF8(s, "?")
+}
@@ -0,0 +1,128 @@
+package benchmark
+
+import "testing"
+
+func TestVerifyTestStructPaths(t *testing.T) {
+	_, want := NewTestStruct(5)
+	_, got := NewTestStruct(5)
+	if mismatches := VerifyTestStruct(got, want, VerifyFull); len(mismatches) > 0 {
+		t.Fatalf("equal values mismatch: %v", mismatches)
+	}
+
+	got.TestProto.TestChildren[1].TestStrings[0] = "changed"
+	got.TestChildrenPtr[0].TestSkip = "changed"
+	delete(got.TestProto.TestMap, "pb_key1_5")
+	got.Flag++
+	mismatches := VerifyTestStruct(got, want, VerifyFull)
+	paths := map[string]bool{}
+	for _, m := range mismatches {
+		paths[m.Path] = true
+	}
+	for _, path := range []string{
+		"TestProto.TestChildren[1].TestStrings[0]",
+		"TestChildrenPtr[0].TestSkip",
+		`TestProto.TestMap["pb_key1_5"]`,
+		"Flag",
+	} {
+		if !paths[path] {
+			t.Errorf("no mismatch at %s in %v", path, mismatches)
+		}
+	}
+	if len(mismatches) != 4 {
+		t.Errorf("want 4 mismatches, got %v", mismatches)
+	}
+
+	// only the protobuf field is compared
+	if mismatches := VerifyTestStruct(got, want, VerifyProto); len(mismatches) != 2 {
+		t.Errorf("want 2 protobuf mismatches, got %v", mismatches)
+	}
+}
+
+func TestVerifyFlat(t *testing.T) {
+	_, want := NewTestStruct(9)
+	_, got := NewTestStruct(9)
+	// a flat copy loses the skip-tagged fields and the maps
+	got.TestChild.TestSkip = ""
+	for i := range got.TestChildren {
+		got.TestChildren[i].TestSkip = ""
+	}
+	got.TestChildPtr.TestSkip = ""
+	for _, c := range got.TestChildrenPtr {
+		c.TestSkip = ""
+	}
+	got.TestProto.TestMap = nil
+	got.TestProto.TestChild.TestMap = nil
+	for _, c := range got.TestProto.TestChildren {
+		c.TestMap = nil
+	}
+	if mismatches := VerifyTestStruct(got, want, VerifyFlat); len(mismatches) > 0 {
+		t.Fatalf("flat copy mismatches: %v", mismatches)
+	}
+	if mismatches := VerifyTestStruct(got, want, VerifyFull); len(mismatches) == 0 {
+		t.Fatal("flat copy verified as a full one")
+	}
+
+	got.TestChild.TestSkip = "kept"
+	mismatches := VerifyTestStruct(got, want, VerifyFlat)
+	if len(mismatches) != 1 || mismatches[0].Path != "TestChild.TestSkip" || mismatches[0].Want != "zero" {
+		t.Fatalf("want TestChild.TestSkip expected zero, got %v", mismatches)
+	}
+}
+
+func TestDeepVerifyNil(t *testing.T) {
+	_, want := NewTestStruct(1)
+	mismatches := VerifyTestStruct(&TestStruct{Id: 1}, want, VerifyFull)
+	want0 := Mismatch{Path: "TestProto", Got: "nil", Want: "non-nil"}
+	found := false
+	for _, m := range mismatches {
+		found = found || m == want0
+	}
+	if !found {
+		t.Fatalf("no nil TestProto mismatch in %v", mismatches)
+	}
+	if m := DeepVerify("", 1, "1", false); len(m) != 1 || m[0].Got != "int" {
+		t.Fatalf("want a type mismatch, got %v", m)
+	}
+}
+
+// TestVerifyRoundTrip sets values into every cache and verifies them in the
+// mode of the cache
+func TestVerifyRoundTrip(t *testing.T) {
+	// small fits in heyicache, the other profiles can go over its entry limit
+	wl := DefaultWorkload.WithValues(ValueProfiles["small"])
+	for _, factory := range Adapters {
+		cache, err := factory.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mode := VerifyModeOf(cache)
+		for id := 0; id < 50; id++ {
+			k, v := wl.NewTestStruct(id)
+			if err := cache.Set(k, v); err != nil {
+				t.Fatalf("%s: set %s: %v", factory.Name, k, err)
+			}
+			scope := beginScope(cache)
+			got, ok := scope.Get(k)
+			if !ok {
+				t.Fatalf("%s: %s not found", factory.Name, k)
+			}
+			for _, m := range VerifyTestStruct(got, v, mode) {
+				if known := KnownMismatches[factory.Name]; known != nil && known(m) {
+					if id == 0 {
+						t.Logf("%s: known: %s", factory.Name, m)
+					}
+					continue
+				}
+				t.Errorf("%s (%s): record %d: %s", factory.Name, mode, id, m)
+			}
+			scope.Done()
+		}
+		closeCache(cache)
+	}
+	if mode := VerifyModeOf(NewTestHeyiCache(32)); mode != VerifyFlat {
+		t.Errorf("heyicache verifies %s, want flat", mode)
+	}
+	if mode := VerifyModeOf(NewTestFreeCache(1 << 20)); mode != VerifyFlat {
+		t.Errorf("freecache verifies %s, want flat", mode)
+	}
+}
@@ -0,0 +1,342 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Op uint8
+
+const (
+	OpRead Op = iota
+	OpWrite
+	OpDelete
+	OpVerify
+	OpPeek
+)
+
+var opNames = [...]string{"read", "write", "delete", "verify", "peek"}
+
+func (op Op) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+	return fmt.Sprintf("op(%d)", op)
+}
+
+// Workload is the operation mix the engine samples for every operation.
+// Read, Write, Delete, Verify and Peek are percentages and must add up to 100,
+// Verify is a read that also checks the returned value, Peek is a read that
+// does not touch the access time of the entry (falls back to a read when the
+// cache cannot peek)
+type Workload struct {
+	Name   string
+	Read   float64
+	Write  float64
+	Delete float64
+	Verify float64
+	Peek   float64
+
+	Keys          KeyDistribution // how the record of every operation is picked
+	Records       int             // keys are picked in [0, Records)
+	Preload       bool            // set every record before the timer starts, like the YCSB load phase
+	Goroutines    int             // concurrent clients
+	OpsPerRequest int             // operations inside one request scope (one heyicache lease)
+	Seed          uint64          // seed of the per goroutine random sources
+	Latency       bool            // record a latency histogram per operation type
+	FillOnMiss    bool            // cache-aside: a read that misses sets the record, counted as a write
+	ReadModify    bool            // every write reads its record first in the same scope, counted as a read and a write
+	AppLoad       bool            // run an allocation heavy application goroutine next to the cache
+	Values        *ValueProfile   // shape of the values, nil is the fixed shape of NewTestStruct
+	Pool          PoolMode        // when the keys and values are built, see Prepare
+	LeaseCheck    LeaseCheck      // check the values read for changes during or after their request scope
+	TTL           TTLDistribution // ttl of every record, nil never expires
+	SimTick       time.Duration   // simulated time every operation takes, 0 runs on the system clock
+	BaselineLoop  bool            // run the loop of the original benchmark instead of sampling the mix, see baselineOp
+
+	// Rate is the target operations per second of all goroutines together,
+	// 0 runs closed loop: every goroutine issues the next operation as soon
+	// as the previous one returns. In open loop the latency is measured from
+	// the intended start of the operation, so it includes the time spent
+	// waiting behind slower operations
+	Rate    float64
+	Arrival Arrival
+
+	// Clock is the simulated clock SimTick moves, the caches must be built
+	// on it, see WithTTL and withSimClock
+	Clock *SimClock
+
+	prep *prepared
+}
+
+var (
+	// DefaultWorkload keeps the ratio of the original benchmark: 1 write, 98
+	// reads and 1 verified read out of every 100 operations
+	DefaultWorkload = Workload{
+		Name:          "default",
+		Read:          98,
+		Write:         1,
+		Verify:        1,
+		Keys:          ZipfianKeys{Theta: 0.99},
+		Records:       10000,
+		Preload:       true,
+		Goroutines:    100,
+		OpsPerRequest: 100,
+		Latency:       true,
+	}
+
+	// BaselineWorkload is the loop of the original benchmark: request i of
+	// every goroutine writes record i % maxNum, reads it back 98 times and
+	// verifies the last read, nothing is loaded before
+	BaselineWorkload = Workload{
+		Name:          "baseline",
+		Read:          98,
+		Write:         1,
+		Verify:        1,
+		Keys:          SequentialKeys{Shared: true},
+		Records:       maxNum,
+		Goroutines:    100,
+		OpsPerRequest: 100,
+		Latency:       true,
+		BaselineLoop:  true,
+	}
+
+	// WorkloadPresets mirror the YCSB core workloads A to D and F. E is left
+	// out, it scans ranges of keys and none of the caches can scan. Inserts
+	// are modelled as writes
+	WorkloadPresets = map[string]Workload{
+		"default":  DefaultWorkload,
+		"baseline": BaselineWorkload,
+		"ycsb-a":   DefaultWorkload.WithMix("ycsb-a", 50, 50, 0, 0, 0),                                  // update heavy
+		"ycsb-b":   DefaultWorkload.WithMix("ycsb-b", 95, 5, 0, 0, 0),                                   // read mostly
+		"ycsb-c":   DefaultWorkload.WithMix("ycsb-c", 100, 0, 0, 0, 0),                                  // read only
+		"ycsb-d":   DefaultWorkload.WithMix("ycsb-d", 95, 5, 0, 0, 0).WithKeys(LatestKeys{Theta: 0.99}), // read latest
+		"ycsb-f":   DefaultWorkload.WithMix("ycsb-f", 50, 50, 0, 0, 0).WithReadModify(),                 // read-modify-write
+		"mixed":    DefaultWorkload.WithMix("mixed", 88, 5, 2, 1, 4),                                    // every operation type
+	}
+)
+
+// WithMix returns a copy of wl with another name and operation mix, sampled
+// even when wl ran the baseline loop
+func (wl Workload) WithMix(name string, read, write, del, verify, peek float64) Workload {
+	wl.Name = name
+	wl.Read, wl.Write, wl.Delete, wl.Verify, wl.Peek = read, write, del, verify, peek
+	wl.BaselineLoop = false
+	return wl
+}
+
+// WithKeys returns a copy of wl picking its records from d
+func (wl Workload) WithKeys(d KeyDistribution) Workload {
+	wl.Keys = d
+	return wl
+}
+
+// WithReadModify returns a copy of wl whose writes read their record first,
+// like the read-modify-write of YCSB F
+func (wl Workload) WithReadModify() Workload {
+	wl.ReadModify = true
+	return wl
+}
+
+// PresetNames returns the preset names in a stable order
+func PresetNames() []string {
+	names := make([]string, 0, len(WorkloadPresets))
+	for name := range WorkloadPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (wl *Workload) Validate() error {
+	for _, p := range []float64{wl.Read, wl.Write, wl.Delete, wl.Verify, wl.Peek} {
+		if p < 0 {
+			return fmt.Errorf("workload %s: negative percentage", wl.Name)
+		}
+	}
+	if sum := wl.Read + wl.Write + wl.Delete + wl.Verify + wl.Peek; sum < 99.999 || sum > 100.001 {
+		return fmt.Errorf("workload %s: operation mix adds up to %.3f%%, want 100%%", wl.Name, sum)
+	}
+	if wl.Keys == nil {
+		return fmt.Errorf("workload %s: no key distribution", wl.Name)
+	}
+	if err := validateKeyDistribution(wl.Keys); err != nil {
+		return fmt.Errorf("workload %s: %v", wl.Name, err)
+	}
+	if wl.Records <= 0 {
+		return fmt.Errorf("workload %s: records must > 0", wl.Name)
+	}
+	if wl.Goroutines <= 0 {
+		return fmt.Errorf("workload %s: goroutines must > 0", wl.Name)
+	}
+	if wl.OpsPerRequest <= 0 {
+		return fmt.Errorf("workload %s: ops per request must > 0", wl.Name)
+	}
+	if wl.Rate < 0 {
+		return fmt.Errorf("workload %s: rate must >= 0", wl.Name)
+	}
+	if wl.SimTick < 0 {
+		return fmt.Errorf("workload %s: sim tick must >= 0", wl.Name)
+	}
+	if wl.SimTick > 0 && wl.Clock == nil {
+		return fmt.Errorf("workload %s: a sim tick needs a simulated clock", wl.Name)
+	}
+	return nil
+}
+
+func (wl *Workload) String() string {
+	s := fmt.Sprintf("%s(read=%g%% write=%g%% delete=%g%% verify=%g%% peek=%g%% keys=%s records=%d goroutines=%d ops/req=%d",
+		wl.Name, wl.Read, wl.Write, wl.Delete, wl.Verify, wl.Peek, wl.Keys.Name(), wl.Records, wl.Goroutines, wl.OpsPerRequest)
+	if wl.Rate > 0 {
+		s += fmt.Sprintf(" rate=%g/s arrival=%s", wl.Rate, wl.Arrival)
+	}
+	if wl.Values != nil {
+		s += " values=" + wl.Values.Name
+	}
+	if wl.Pool != PoolOff {
+		s += " pool=" + wl.Pool.String()
+	}
+	if wl.LeaseCheck != LeaseCheckOff {
+		s += " lease-check=" + wl.LeaseCheck.String()
+	}
+	if wl.TTL != nil {
+		s += " ttl=" + wl.TTL.Name()
+	}
+	if wl.SimTick > 0 {
+		s += " sim-tick=" + wl.SimTick.String()
+	}
+	if wl.ReadModify {
+		s += " read-modify-write"
+	}
+	if wl.BaselineLoop {
+		s += " baseline-loop"
+	}
+	return s + ")"
+}
+
+// ttl is the ttl of record id, 0 when wl doesn't expire its records
+func (wl *Workload) ttl(id int) time.Duration {
+	if wl.TTL == nil {
+		return 0
+	}
+	return wl.TTL.TTL(id)
+}
+
+// WithValues returns a copy of wl building its values with p
+func (wl Workload) WithValues(p *ValueProfile) Workload {
+	wl.Values = p
+	wl.prep = nil
+	return wl
+}
+
+// NewTestStruct returns the key and the value of record id in the value
+// profile of wl
+func (wl *Workload) NewTestStruct(id int) (string, *TestStruct) {
+	if pool := wl.valuePool(); pool != nil {
+		return pool.Get(id)
+	}
+	return wl.build(id)
+}
+
+// build builds record id, bypassing the pool
+func (wl *Workload) build(id int) (string, *TestStruct) {
+	return newTestStruct(wl.Values, id)
+}
+
+// newTestStruct builds record id with p, nil is NewTestStruct
+func newTestStruct(p *ValueProfile, id int) (string, *TestStruct) {
+	if p == nil {
+		return NewTestStruct(id)
+	}
+	return p.NewTestStruct(id)
+}
+
+// WithRate returns a copy of wl running open loop at rate operations per second
+func (wl Workload) WithRate(rate float64, arrival Arrival) Workload {
+	wl.Rate = rate
+	wl.Arrival = arrival
+	return wl
+}
+
+// WithTTL returns a copy of wl expiring its records after d, on a fresh
+// simulated clock moving tick per operation when tick > 0
+func (wl Workload) WithTTL(d TTLDistribution, tick time.Duration) Workload {
+	wl.TTL = d
+	wl.SimTick = tick
+	wl.Clock = nil
+	if tick > 0 {
+		wl.Clock = NewSimClock()
+	}
+	return wl
+}
+
+// opSampler picks operations according to the mix, thresholds are cumulative
+// percentages so one random number decides the operation
+type opSampler struct {
+	thresholds [len(opNames)]float64
+}
+
+func newOpSampler(wl *Workload) opSampler {
+	var s opSampler
+	sum := 0.0
+	for i, p := range []float64{wl.Read, wl.Write, wl.Delete, wl.Verify, wl.Peek} {
+		sum += p
+		s.thresholds[i] = sum
+	}
+	return s
+}
+
+// baselineOp is operation j of a request of the original benchmark loop: all
+// operations of the request are on one record, the first writes it, the
+// others read it back and the last one verifies it
+func baselineOp(j, ops int) Op {
+	switch j {
+	case 0:
+		return OpWrite
+	case ops - 1:
+		return OpVerify
+	}
+	return OpRead
+}
+
+func (s *opSampler) next(r *rand.Rand) Op {
+	x := r.Float64() * s.thresholds[len(s.thresholds)-1]
+	for i, t := range s.thresholds {
+		if x < t {
+			return Op(i)
+		}
+	}
+	return OpRead
+}
+
+// newRand returns the random source of one goroutine, different goroutines
+// get different streams of the same seed
+func newRand(seed uint64, gIdx int) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, uint64(gIdx)))
+}
+
+// LoadRecords sets every record of wl into ifc, with its ttl when wl expires
+// them, it's the load phase that runs before the timer starts
+func LoadRecords(ifc CacheAdapter, wl *Workload) {
+	wl.Prepare()
+	ttlSetter, _ := ifc.(TTLSetter)
+	wg := &sync.WaitGroup{}
+	wg.Add(wl.Goroutines)
+	for g := 0; g < wl.Goroutines; g++ {
+		go func(gIdx int) {
+			defer wg.Done()
+			for id := gIdx; id < wl.Records; id += wl.Goroutines {
+				k, v := wl.NewTestStruct(id)
+				if ttl := wl.ttl(id); ttl > 0 && ttlSetter != nil {
+					_ = ttlSetter.SetWithTTL(k, v, ttl)
+				} else {
+					_ = ifc.Set(k, v)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
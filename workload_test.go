@@ -0,0 +1,68 @@
+package benchmark
+
+import (
+	"math"
+	"testing"
+)
+
+// TestOpSampler checks the sampled operations follow the mix of every preset
+// and of a mix set with WithMix
+func TestOpSampler(t *testing.T) {
+	workloads := []Workload{DefaultWorkload.WithMix("custom", 10, 20, 30, 15, 25)}
+	for _, name := range PresetNames() {
+		workloads = append(workloads, WorkloadPresets[name])
+	}
+	const n = 200000
+	for _, wl := range workloads {
+		sampler := newOpSampler(&wl)
+		r := newRand(1, 0)
+		var counts [len(opNames)]int
+		for i := 0; i < n; i++ {
+			counts[sampler.next(r)]++
+		}
+		for i, want := range []float64{wl.Read, wl.Write, wl.Delete, wl.Verify, wl.Peek} {
+			got := float64(counts[i]) / n * 100
+			// 5 standard deviations of a binomial proportion
+			if tolerance := 5 * math.Sqrt(want*(100-want)/n); math.Abs(got-want) > max(tolerance, 0.01) {
+				t.Errorf("%s: %s sampled %.3f%%, want %g%%", wl.Name, Op(i), got, want)
+			}
+		}
+	}
+}
+
+func TestBaselineLoop(t *testing.T) {
+	wl := BaselineWorkload
+	wl.Goroutines = 4
+	result := RunWorkload(NewTestMap(0), &wl, 50)
+	// every goroutine writes records 0 to 49 once, then reads each back
+	requests := uint64(wl.Goroutines * 50)
+	if result.WriteSuccess != requests || result.CheckSuccess != requests || result.ReadMiss != 0 {
+		t.Fatalf("unexpected result %s", result)
+	}
+	if reads := uint64(wl.OpsPerRequest-1) * requests; result.ReadSuccess != reads {
+		t.Fatalf("%d reads, want %d", result.ReadSuccess, reads)
+	}
+	if wl.WithMix("sampled", 100, 0, 0, 0, 0).BaselineLoop {
+		t.Fatal("a mix set on the baseline loop isn't sampled")
+	}
+	rerun, err := wl.Params().Workload()
+	if err != nil || !rerun.BaselineLoop {
+		t.Fatalf("rerun as %s: %v", rerun.String(), err)
+	}
+}
+
+// TestReadModify checks every write of ycsb-f reads its record first
+func TestReadModify(t *testing.T) {
+	wl := WorkloadPresets["ycsb-f"].WithMix("rmw", 0, 100, 0, 0, 0)
+	wl.Goroutines = 4
+	wl.Records = 100
+	result := RunWorkload(NewTestMap(0), &wl, 50)
+	writes := result.WriteSuccess + result.WriteFail
+	if writes == 0 || result.ReadSuccess+result.ReadMiss != writes {
+		t.Fatalf("unexpected result %s", result)
+	}
+	rerun, err := wl.Params().Workload()
+	if err != nil || !rerun.ReadModify {
+		t.Fatalf("rerun as %s: %v", rerun.String(), err)
+	}
+}